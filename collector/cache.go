@@ -0,0 +1,263 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"github.com/huaweicloud/golangsdk/openstack/ces/v1/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type resourceCacheKey struct {
+	Account   string
+	Project   string
+	Region    string
+	Namespace string
+}
+
+const (
+	resourceRefreshMinFraction   = 0.75
+	resourceRefreshJitter        = 0.15
+	resourceRefreshRetryInterval = time.Minute
+	resourceRefreshTimeout       = time.Minute * 5
+)
+
+type serversInfo struct {
+	RefreshAt     time.Time
+	ExpiresAt     time.Time
+	RefreshedAt   time.Time
+	Info          map[string][]string
+	FilterMetrics []metrics.Metric
+
+	// Err is the error of the last listing, if it failed
+	Err error
+
+	// listing is closed once the listing in flight completes, it is nil while
+	// none is, listings are never done while holding the lock
+	listing chan struct{}
+	sync.Mutex
+}
+
+// ResourceCache keeps the resources discovered by the namespace providers, so
+// that they are not listed again on every scrape. Entries are kept apart per
+// account, project, region and namespace.
+type ResourceCache struct {
+	entries map[resourceCacheKey]*serversInfo
+	sync.Mutex
+}
+
+func NewResourceCache() *ResourceCache {
+	return &ResourceCache{
+		entries: make(map[resourceCacheKey]*serversInfo),
+	}
+}
+
+func (r *ResourceCache) get(key resourceCacheKey) *serversInfo {
+	r.Lock()
+	defer r.Unlock()
+
+	info, ok := r.entries[key]
+	if !ok {
+		info = &serversInfo{}
+		r.entries[key] = info
+	}
+
+	return info
+}
+
+// retain drops the entries of all the accounts but the given ones.
+func (r *ResourceCache) retain(accounts map[string]bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	for key := range r.entries {
+		if !accounts[key.Account] {
+			delete(r.entries, key)
+		}
+	}
+}
+
+// Describe and Collect export the age of every entry of the cache.
+func (r *ResourceCache) Describe(ch chan<- *prometheus.Desc) {
+	ch <- resourceCacheAgeDesc
+}
+
+func (r *ResourceCache) Collect(ch chan<- prometheus.Metric) {
+	// the entries are read apart from the cache lock, so that no scrape waits
+	// on the cache while an entry is busy
+	r.Lock()
+	entries := make(map[resourceCacheKey]*serversInfo, len(r.entries))
+	for key, info := range r.entries {
+		entries[key] = info
+	}
+	r.Unlock()
+
+	for key, info := range entries {
+		info.Lock()
+		refreshedAt := info.RefreshedAt
+		loaded := info.Info != nil
+		info.Unlock()
+
+		if !loaded {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(resourceCacheAgeDesc, prometheus.GaugeValue, time.Since(refreshedAt).Seconds(), key.Account, key.Namespace)
+	}
+}
+
+// update stores freshly listed resources and schedules their next refresh at
+// a random point between 75% and 90% of their ttl, so that the refreshes of
+// the namespaces do not all fall on the same scrape. The caller must hold the
+// lock.
+func (s *serversInfo) update(resources *Resources, ttl time.Duration) {
+	s.Info = resources.Info
+	s.FilterMetrics = resources.FilterMetrics
+	s.Err = nil
+	s.RefreshedAt = time.Now()
+	s.ExpiresAt = s.RefreshedAt.Add(ttl)
+
+	fraction := resourceRefreshMinFraction + rand.Float64()*resourceRefreshJitter
+	s.RefreshAt = s.RefreshedAt.Add(time.Duration(float64(ttl) * fraction))
+}
+
+// getAllResources returns the cached resources of a namespace. Only the first
+// listing of a namespace is waited for, until ctx is done, afterwards the
+// resources are refreshed in the background before they expire, while the
+// previous ones keep being served. Listings are never bound to a scrape, a
+// first listing outlasting the scrape still fills the cache for the next one.
+//
+// The error of the last listing is returned when there are no resources to
+// serve, or when the served ones have expired.
+func (c *CloudEyeExporter) getAllResources(ctx context.Context, namespace string) (map[string][]string, []metrics.Metric, error) {
+	provider, ok := GetNamespaceProvider(namespace)
+	if !ok {
+		return map[string][]string{}, []metrics.Metric{}, nil
+	}
+
+	ttl := c.CloudConfig.GetResourceTTL(namespace)
+	info := c.resourceCache.get(resourceCacheKey{
+		Account:   c.Account,
+		Project:   c.Project,
+		Region:    c.Region,
+		Namespace: namespace,
+	})
+
+	info.Lock()
+	now := time.Now()
+	switch {
+	case info.Info == nil:
+		resourceCacheRequests.WithLabelValues(namespace, "miss").Inc()
+		listing := info.listing
+		if listing == nil && info.Err != nil && now.Before(info.RefreshAt) {
+			// the failed first listing is not retried before its time
+			err := info.Err
+			info.Unlock()
+			return nil, nil, err
+		}
+		if listing == nil {
+			listing = c.listResources(provider, namespace, info, ttl)
+		}
+		info.Unlock()
+
+		select {
+		case <-listing:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+
+		info.Lock()
+	case now.After(info.RefreshAt):
+		if now.After(info.ExpiresAt) {
+			resourceCacheRequests.WithLabelValues(namespace, "stale").Inc()
+		} else {
+			resourceCacheRequests.WithLabelValues(namespace, "hit").Inc()
+		}
+		if info.listing == nil {
+			c.listResources(provider, namespace, info, ttl)
+		}
+	default:
+		resourceCacheRequests.WithLabelValues(namespace, "hit").Inc()
+	}
+	defer info.Unlock()
+
+	if info.Info == nil {
+		return nil, nil, info.Err
+	}
+
+	if info.Err != nil && time.Now().After(info.ExpiresAt) {
+		return info.Info, info.FilterMetrics, info.Err
+	}
+
+	return info.Info, info.FilterMetrics, nil
+}
+
+// listResources lists the resources of a namespace in the background, apart
+// from any scrape, and returns a channel closed once the listing completes. A
+// failed listing is retried by the scrapes after resourceRefreshRetryInterval.
+// The caller must hold the lock.
+func (c *CloudEyeExporter) listResources(provider NamespaceProvider, namespace string, info *serversInfo, ttl time.Duration) chan struct{} {
+	listing := make(chan struct{})
+	info.listing = listing
+
+	go func() {
+		defer close(listing)
+
+		ctx, cancel := context.WithTimeout(context.Background(), resourceRefreshTimeout)
+		defer cancel()
+
+		resources, err := c.getResources(provider, c.pooledClient.WithContext(ctx))
+
+		info.Lock()
+		defer info.Unlock()
+
+		info.listing = nil
+		if err != nil {
+			slog.Error(fmt.Sprintf("listing the resources of %s of account %s failed: %s", namespace, c.Account, err.Error()))
+			resourceCacheRefreshFailures.WithLabelValues(c.Account, namespace).Inc()
+			info.Err = err
+			info.RefreshAt = time.Now().Add(resourceRefreshRetryInterval)
+			return
+		}
+
+		info.update(resources, ttl)
+		slog.Debug(fmt.Sprintf("listed the resources of %s of account %s, resource count: %d", namespace, c.Account, len(resources.Info)))
+	}()
+
+	return listing
+}
+
+// getResources lists the resources of a namespace and appends the values of
+// the configured tags to their extension label values, if the provider reads
+// the tags of its resources.
+func (c *CloudEyeExporter) getResources(provider NamespaceProvider, client *OpenTelekomCloudClient) (*Resources, error) {
+	tagLabels := c.CloudConfig.Global.TagLabels
+	withTags := len(tagLabels.Keys) > 0 && providesTags(provider.Namespace())
+	resources, err := provider.Resources(client, ResourceOptions{
+		Filters:  c.CloudConfig.GetMetricFilters(provider.Namespace()),
+		WithTags: withTags,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !withTags {
+		return resources, nil
+	}
+
+	for id, values := range resources.Info {
+		for _, key := range tagLabels.Keys {
+			value, ok := resources.Tags[id][key]
+			if !ok {
+				value = tagLabels.Default
+			}
+			values = append(values, value)
+		}
+		resources.Info[id] = values
+	}
+
+	return resources, nil
+}
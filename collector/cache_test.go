@@ -0,0 +1,187 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/akyriako/cloudeye-exporter/config"
+	"github.com/huaweicloud/golangsdk"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingProvider lists a single resource named after the number of listings
+// so far, or fails to list it while err is set.
+type countingProvider struct {
+	namespace string
+	listings  int
+	err       error
+	sync.Mutex
+}
+
+func (p *countingProvider) Namespace() string {
+	return p.namespace
+}
+
+func (p *countingProvider) ServiceClient(client *OpenTelekomCloudClient) (*golangsdk.ServiceClient, error) {
+	return client.GetCESClient()
+}
+
+func (p *countingProvider) ExtensionLabels() map[string][]string {
+	return nil
+}
+
+func (p *countingProvider) Resources(client *OpenTelekomCloudClient, options ResourceOptions) (*Resources, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.listings++
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	resources := newResources()
+	resources.Info[fmt.Sprintf("listing-%d", p.listings)] = []string{}
+	return resources, nil
+}
+
+func (p *countingProvider) getListings() int {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.listings
+}
+
+func newTestCacheExporter(t *testing.T, cache *ResourceCache, account string) *CloudEyeExporter {
+	t.Helper()
+
+	client, _ := newTestClient(t, &fakeIAM{lifetime: 24 * time.Hour})
+	return &CloudEyeExporter{
+		CloudConfig:   &config.CloudConfig{Global: config.Global{ResourceTTL: time.Hour}},
+		Account:       account,
+		pooledClient:  client,
+		resourceCache: cache,
+	}
+}
+
+func getResourceIDs(t *testing.T, exporter *CloudEyeExporter, namespace string) []string {
+	t.Helper()
+
+	info, _, err := exporter.getAllResources(context.Background(), namespace)
+	if err != nil {
+		t.Fatalf("getAllResources() error = %v", err)
+	}
+
+	ids := make([]string, 0, len(info))
+	for id := range info {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func TestResourceCache(t *testing.T) {
+	provider := &countingProvider{namespace: "CUSTOM_NS.cached"}
+	RegisterNamespaceProvider(provider)
+
+	cache := NewResourceCache()
+	production := newTestCacheExporter(t, cache, "production")
+	staging := newTestCacheExporter(t, cache, "staging")
+
+	if ids := getResourceIDs(t, production, "CUSTOM_NS.cached"); len(ids) != 1 || ids[0] != "listing-1" {
+		t.Errorf("resources = %v, want the first listing", ids)
+	}
+	if ids := getResourceIDs(t, production, "CUSTOM_NS.cached"); len(ids) != 1 || ids[0] != "listing-1" {
+		t.Errorf("resources = %v, want the cached first listing", ids)
+	}
+	if ids := getResourceIDs(t, staging, "CUSTOM_NS.cached"); len(ids) != 1 || ids[0] != "listing-2" {
+		t.Errorf("resources of another account = %v, want a listing of their own", ids)
+	}
+	if provider.getListings() != 2 {
+		t.Errorf("listings = %d, want one per account", provider.getListings())
+	}
+
+	cache.retain(map[string]bool{"staging": true})
+	if len(cache.entries) != 1 {
+		t.Errorf("entries = %v, want only the entry of the retained account", cache.entries)
+	}
+
+	provider.Lock()
+	provider.err = errors.New("listing failed")
+	provider.Unlock()
+	if _, _, err := production.getAllResources(context.Background(), "CUSTOM_NS.cached"); err == nil {
+		t.Error("getAllResources() succeeded, want the error of the failed first listing")
+	}
+}
+
+// waitForListing waits for the listing of an entry in flight, if any.
+func waitForListing(info *serversInfo) {
+	info.Lock()
+	listing := info.listing
+	info.Unlock()
+
+	if listing != nil {
+		<-listing
+	}
+}
+
+func TestGetAllResourcesRefreshesInBackground(t *testing.T) {
+	provider := &countingProvider{namespace: "CUSTOM_NS.refreshed"}
+	RegisterNamespaceProvider(provider)
+
+	cache := NewResourceCache()
+	exporter := newTestCacheExporter(t, cache, "production")
+	info := cache.get(resourceCacheKey{Account: "production", Namespace: "CUSTOM_NS.refreshed"})
+	getResourceIDs(t, exporter, "CUSTOM_NS.refreshed")
+
+	info.Lock()
+	info.RefreshAt = time.Now().Add(-time.Second)
+	info.Unlock()
+	if ids := getResourceIDs(t, exporter, "CUSTOM_NS.refreshed"); len(ids) != 1 || ids[0] != "listing-1" {
+		t.Errorf("resources = %v, want the previous listing while refreshing", ids)
+	}
+	waitForListing(info)
+	if ids := getResourceIDs(t, exporter, "CUSTOM_NS.refreshed"); len(ids) != 1 || ids[0] != "listing-2" {
+		t.Errorf("resources = %v, want the refreshed listing", ids)
+	}
+
+	provider.Lock()
+	provider.err = errors.New("listing failed")
+	provider.Unlock()
+	info.Lock()
+	info.RefreshAt = time.Now().Add(-time.Second)
+	info.Unlock()
+	getResourceIDs(t, exporter, "CUSTOM_NS.refreshed")
+	waitForListing(info)
+
+	if ids := getResourceIDs(t, exporter, "CUSTOM_NS.refreshed"); len(ids) != 1 || ids[0] != "listing-2" {
+		t.Errorf("resources = %v, want the previous listing after a failed refresh", ids)
+	}
+	info.Lock()
+	retryIn := time.Until(info.RefreshAt)
+	info.ExpiresAt = time.Now().Add(-time.Second)
+	info.Unlock()
+	if retryIn <= 0 || retryIn > resourceRefreshRetryInterval {
+		t.Errorf("failed refresh retried in %s, want within %s", retryIn, resourceRefreshRetryInterval)
+	}
+
+	resources, _, err := exporter.getAllResources(context.Background(), "CUSTOM_NS.refreshed")
+	if len(resources) != 1 || err == nil {
+		t.Errorf("getAllResources() = %v, %v, want the expired resources along with the error", resources, err)
+	}
+}
+
+func TestServersInfoUpdate(t *testing.T) {
+	ttl := time.Hour
+	for i := 0; i < 100; i++ {
+		var info serversInfo
+		info.Err = errors.New("listing failed")
+		info.update(newResources(), ttl)
+
+		refreshIn := info.RefreshAt.Sub(info.RefreshedAt)
+		if refreshIn < 45*time.Minute || refreshIn > 54*time.Minute || info.ExpiresAt.Sub(info.RefreshedAt) != ttl || info.Err != nil {
+			t.Fatalf("refresh in %s, expiry in %s, err %v, want a refresh between 75%% and 90%% of the ttl", refreshIn, info.ExpiresAt.Sub(info.RefreshedAt), info.Err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/akyriako/cloudeye-exporter/config"
@@ -8,11 +9,16 @@ import (
 	"github.com/huaweicloud/golangsdk/openstack"
 	"github.com/huaweicloud/golangsdk/openstack/autoscaling/v1/groups"
 	"github.com/huaweicloud/golangsdk/openstack/blockstorage/v2/volumes"
+	"github.com/huaweicloud/golangsdk/openstack/ces/v1/metrics"
+	"github.com/huaweicloud/golangsdk/openstack/common/tags"
 	"github.com/huaweicloud/golangsdk/openstack/compute/v2/servers"
 	dcs "github.com/huaweicloud/golangsdk/openstack/dcs/v1/instances"
 	dms "github.com/huaweicloud/golangsdk/openstack/dms/v1/instances"
 	"github.com/huaweicloud/golangsdk/openstack/dms/v1/queues"
+	"github.com/huaweicloud/golangsdk/openstack/dms/v2/kafka/topics"
+	"github.com/huaweicloud/golangsdk/openstack/ecs/v1/cloudservers"
 	"github.com/huaweicloud/golangsdk/openstack/fgs/v2/function"
+	"github.com/huaweicloud/golangsdk/openstack/identity/v3/tokens"
 	"github.com/huaweicloud/golangsdk/openstack/networking/v2/extensions/lbaas_v2/listeners"
 	"github.com/huaweicloud/golangsdk/openstack/networking/v2/extensions/lbaas_v2/loadbalancers"
 	"github.com/huaweicloud/golangsdk/openstack/networking/v2/extensions/natgateways"
@@ -21,6 +27,11 @@ import (
 	"github.com/huaweicloud/golangsdk/openstack/vpc/v1/publicips"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type ClientConfig struct {
@@ -38,22 +49,42 @@ type ClientConfig struct {
 	Token            string
 	Username         string
 	UserID           string
+	Transport        http.RoundTripper
 }
 
+const (
+	// tokens are renewed an hour before they expire, or halfway through their
+	// lifetime if they are shorter lived, to avoid requests failing at the edge
+	// of expiration. IAM tokens are assumed to be valid for 24 hours if their
+	// expiry cannot be read.
+	tokenRenewalMargin = time.Hour
+	tokenLifetime      = time.Hour * 24
+)
+
 type OpenTelekomCloudClient struct {
 	HwClient *golangsdk.ProviderClient
 	Config   ClientConfig
+
+	endpoints *serviceEndpoints
+
+	// expiresAt is the point in time the current token has to be renewed, it
+	// is zero for AK/SK clients as they sign every request and carry no token.
+	expiresAt time.Time
+	sync.Mutex
 }
 
-func NewOpenTelekomCloudClient(config *config.CloudConfig) (*OpenTelekomCloudClient, error) {
-	auth := config.Auth
+func NewOpenTelekomCloudClient(auth config.CloudAuth, transport http.RoundTripper) (*OpenTelekomCloudClient, error) {
 	clientConfig := ClientConfig{
+		Transport:        transport,
 		IdentityEndpoint: auth.AuthURL,
 		TenantName:       auth.ProjectName,
+		TenantID:         auth.ProjectID,
 		AccessKey:        auth.AccessKey,
 		SecretKey:        auth.SecretKey,
 		DomainName:       auth.DomainName,
+		DomainID:         auth.DomainID,
 		Username:         auth.UserName,
+		UserID:           auth.UserID,
 		Region:           auth.Region,
 		Password:         auth.Password,
 		Insecure:         true,
@@ -82,10 +113,11 @@ func buildClientByPassword(c *ClientConfig) (*OpenTelekomCloudClient, error) {
 	var pao, dao golangsdk.AuthOptions
 
 	pao = golangsdk.AuthOptions{
-		DomainID:   c.DomainID,
-		DomainName: c.DomainName,
-		TenantID:   c.TenantID,
-		TenantName: c.TenantName,
+		DomainID:    c.DomainID,
+		DomainName:  c.DomainName,
+		TenantID:    c.TenantID,
+		TenantName:  c.TenantName,
+		AllowReauth: true,
 	}
 
 	dao = golangsdk.AuthOptions{
@@ -93,6 +125,13 @@ func buildClientByPassword(c *ClientConfig) (*OpenTelekomCloudClient, error) {
 		DomainName: c.DomainName,
 	}
 
+	// a user given by id must not carry a domain, the project is then scoped
+	// by id alone
+	if c.UserID != "" {
+		pao.DomainID, pao.DomainName = "", ""
+		dao.DomainID, dao.DomainName = "", ""
+	}
+
 	for _, ao := range []*golangsdk.AuthOptions{&pao, &dao} {
 		ao.IdentityEndpoint = c.IdentityEndpoint
 		ao.Password = c.Password
@@ -125,26 +164,137 @@ func buildClientByAKSK(c *ClientConfig) (*OpenTelekomCloudClient, error) {
 }
 
 func newOpenTelekomCloudClient(c *ClientConfig, pao, dao golangsdk.AuthOptionsProvider) (*OpenTelekomCloudClient, error) {
-	openstackClient, err := newOpenStackClient(c, pao)
+	endpoints := newServiceEndpoints()
+	openstackClient, err := newOpenStackClient(c, pao, endpoints)
 	if err != nil {
 		return nil, err
 	}
 
 	client := &OpenTelekomCloudClient{
-		HwClient: openstackClient,
-		Config:   *c,
+		HwClient:  openstackClient,
+		Config:    *c,
+		endpoints: endpoints,
+	}
+	if openstackClient.Token() != "" {
+		client.expiresAt = client.tokenRenewalTime()
 	}
 
 	return client, err
 }
 
-func newOpenStackClient(c *ClientConfig, ao golangsdk.AuthOptionsProvider) (*golangsdk.ProviderClient, error) {
+// tokenRenewalTime returns the point in time the current token has to be
+// renewed, ahead of the expiry IAM reports for it.
+func (c *OpenTelekomCloudClient) tokenRenewalTime() time.Time {
+	expiresAt, err := c.getTokenExpiry()
+	if err != nil {
+		slog.Warn(fmt.Sprintf("reading the expiry of the token failed, assuming a lifetime of %s: %s", tokenLifetime, err.Error()))
+		expiresAt = time.Now().Add(tokenLifetime)
+	}
+
+	return expiresAt.Add(-min(tokenRenewalMargin, max(0, time.Until(expiresAt)/2)))
+}
+
+func (c *OpenTelekomCloudClient) getTokenExpiry() (time.Time, error) {
+	client, err := openstack.NewIdentityV3(c.HwClient, golangsdk.EndpointOpts{})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	token, err := tokens.Get(client, c.HwClient.Token()).ExtractToken()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return token.ExpiresAt, nil
+}
+
+// renewTokenIfExpired re-authenticates against IAM when the token of the client
+// is about to expire. Expired tokens are also renewed transparently by the sdk
+// on a 401 response, as long as the client was built with password credentials.
+func (c *OpenTelekomCloudClient) renewTokenIfExpired() error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.expiresAt.IsZero() || time.Now().Before(c.expiresAt) {
+		return nil
+	}
+
+	return c.renewToken(c.HwClient.Token())
+}
+
+// reauthenticate renews the token after it was rejected, unless it was renewed
+// since previousToken was sent.
+func (c *OpenTelekomCloudClient) reauthenticate(previousToken string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.HwClient.Token() != previousToken {
+		return nil
+	}
+
+	return c.renewToken(previousToken)
+}
+
+// renewToken re-authenticates against IAM and schedules the next renewal. The
+// caller must hold the lock.
+func (c *OpenTelekomCloudClient) renewToken(previousToken string) error {
+	err := c.HwClient.Reauthenticate(previousToken)
+	if err != nil {
+		return err
+	}
+
+	c.expiresAt = c.tokenRenewalTime()
+	return nil
+}
+
+// WithContext returns a copy of the client whose requests are bound to ctx,
+// so that they are cancelled along with it. The copy shares the token, and
+// its renewal, with the client it was derived from, but guards its own copy
+// of the token with locks of its own.
+func (c *OpenTelekomCloudClient) WithContext(ctx context.Context) *OpenTelekomCloudClient {
+	c.Lock()
+	hwClient := *c.HwClient
+	c.Unlock()
+
+	hwClient.Context = ctx
+	hwClient.UseTokenLock()
+
+	if c.HwClient.ReauthFunc != nil {
+		// the sdk calls ReauthFunc while holding the token lock of the copy,
+		// so the token of the copy is accessed directly
+		hwClient.ReauthFunc = func() error {
+			err := c.reauthenticate(hwClient.TokenID)
+			if err != nil {
+				return err
+			}
+
+			hwClient.TokenID = c.HwClient.Token()
+			return nil
+		}
+	}
+
+	return &OpenTelekomCloudClient{
+		HwClient:  &hwClient,
+		Config:    c.Config,
+		endpoints: c.endpoints,
+	}
+}
+
+func newOpenStackClient(c *ClientConfig, ao golangsdk.AuthOptionsProvider, endpoints *serviceEndpoints) (*golangsdk.ProviderClient, error) {
 	client, err := openstack.NewClient(ao.GetIdentityEndpoint())
 	if err != nil {
 		return nil, err
 	}
 
+	// the provider client is shared among concurrent scrapes, token access
+	// has to be synchronized
+	client.UseTokenLock()
+
 	client.HTTPClient = http.Client{
+		Transport: &serviceTransport{
+			next:      c.Transport,
+			endpoints: endpoints,
+		},
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			if client.AKSKAuthOptions.AccessKey != "" {
 				golangsdk.ReSign(req, golangsdk.SignOptions{
@@ -165,32 +315,15 @@ func newOpenStackClient(c *ClientConfig, ao golangsdk.AuthOptionsProvider) (*gol
 }
 
 func (c *OpenTelekomCloudClient) GetServiceEndpoint(namespace string) (*golangsdk.ServiceClient, error) {
-	switch namespace {
-	case "SYS.CES":
+	if namespace == "SYS.CES" {
 		return c.GetCESClient()
-	case "SYS.ELB":
-		return c.GetELBClient()
-	case "SYS.NAT":
-		return c.GetNATClient()
-	case "SYS.RDS":
-		return c.GetRDSClient()
-	case "SYS.DCS":
-		return c.GetDCSClient()
-	case "SYS.DMS":
-		return c.GetDMSClient()
-	case "SYS.VPC":
-		return c.GetVPCClient()
-	case "SYS.EVS":
-		return c.GetEVSClient()
-	case "SYS.ECS":
-		return c.GetECSClient()
-	case "SYS.AS":
-		return c.GetASClient()
-	case "SYS.FGS":
-		return c.GetFGSClient()
-	default:
-		return nil, fmt.Errorf("could not provide a service endpoint for namespace: %s", namespace)
 	}
+
+	if provider, ok := GetNamespaceProvider(namespace); ok {
+		return provider.ServiceClient(c)
+	}
+
+	return nil, fmt.Errorf("could not provide a service endpoint for namespace: %s", namespace)
 }
 
 func (c *OpenTelekomCloudClient) getAllLoadBalancers() (*[]loadbalancers.LoadBalancer, error) {
@@ -341,6 +474,59 @@ func (c *OpenTelekomCloudClient) getAllDMSQueues() (*[]queues.Queue, error) {
 	return &allQueues, nil
 }
 
+func (c *OpenTelekomCloudClient) getAllKafkaTopics(instanceID string) ([]topics.Topic, error) {
+	client, err := c.GetDMSClient()
+	if err != nil {
+		return nil, err
+	}
+
+	allTopics, err := topics.List(client, instanceID).Extract()
+	if err != nil {
+		slog.Error(fmt.Sprintf("getting all topics of kafka instance %s failed: %s", instanceID, err.Error()))
+		return nil, err
+	}
+
+	return allTopics, nil
+}
+
+// getKafkaBrokers returns the brokers of a Kafka instance, as found in the
+// dimensions of its metricName metrics in CES, the instance listing does not
+// report them.
+func (c *OpenTelekomCloudClient) getKafkaBrokers(instanceID string, metricName string) ([]string, error) {
+	client, err := c.GetCESClient()
+	if err != nil {
+		return nil, err
+	}
+
+	limit := 1000
+	allPages, err := metrics.List(client, metrics.ListOpts{
+		Namespace:  "SYS.DMS",
+		MetricName: metricName,
+		Dim0:       fmt.Sprintf("kafka_instance_id,%s", instanceID),
+		Limit:      &limit,
+	}).AllPages()
+	if err != nil {
+		slog.Error(fmt.Sprintf("getting the brokers of kafka instance %s failed: %s", instanceID, err.Error()))
+		return nil, err
+	}
+
+	v, err := metrics.ExtractAllPagesMetrics(allPages)
+	if err != nil {
+		return nil, err
+	}
+
+	brokers := make([]string, 0)
+	for _, metric := range v.Metrics {
+		for _, dimension := range metric.Dimensions {
+			if dimension.Name == "kafka_broker" && !slices.Contains(brokers, dimension.Value) {
+				brokers = append(brokers, dimension.Value)
+			}
+		}
+	}
+
+	return brokers, nil
+}
+
 func (c *OpenTelekomCloudClient) getAllPublicIPs() (*[]publicips.PublicIP, error) {
 	client, err := c.GetVPCClient()
 	if err != nil {
@@ -355,9 +541,8 @@ func (c *OpenTelekomCloudClient) getAllPublicIPs() (*[]publicips.PublicIP, error
 		slog.Error(fmt.Sprintf("getting all public ip pages failed: %s", err.Error()))
 		return nil, err
 	}
-	publicipList, err1 := publicips.ExtractPublicIPs(allPages)
-
-	if err1 != nil {
+	publicipList, err := publicips.ExtractPublicIPs(allPages)
+	if err != nil {
 		slog.Error(fmt.Sprintf("extracting all public ip pages failed: %s", err.Error()))
 		return nil, err
 	}
@@ -475,3 +660,116 @@ func (c *OpenTelekomCloudClient) getAllFunctions() (*function.FunctionList, erro
 
 	return &result, nil
 }
+
+// getAllELBTags returns the tags of all load balancers, keyed by load balancer
+// id, with the batch tag query of ELB instead of a request per load balancer.
+func (c *OpenTelekomCloudClient) getAllELBTags() (map[string]map[string]string, error) {
+	client, err := c.GetELBClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return listResourceTags(client, "loadbalancers")
+}
+
+func (c *OpenTelekomCloudClient) getDCSTags(id string) (map[string]string, error) {
+	client, err := c.GetDCSClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return getResourceTags(client, "dcs", id)
+}
+
+// getAllECSTags returns the tags of all servers, keyed by server id. Unlike the
+// compute API, the ECS API returns the tags along with the servers, as
+// key=value strings.
+func (c *OpenTelekomCloudClient) getAllECSTags() (map[string]map[string]string, error) {
+	client, err := c.GetECSV1Client()
+	if err != nil {
+		return nil, err
+	}
+
+	allPages, err := cloudservers.List(client, cloudservers.ListOpts{
+		Limit: 1000,
+	}).AllPages()
+	if err != nil {
+		slog.Error(fmt.Sprintf("getting all cloud server pages failed: %s", err.Error()))
+		return nil, err
+	}
+
+	allServers, err := cloudservers.ExtractServers(allPages)
+	if err != nil {
+		slog.Error(fmt.Sprintf("extracting all cloud server pages failed: %s", err.Error()))
+		return nil, err
+	}
+
+	result := make(map[string]map[string]string, len(allServers))
+	for _, server := range allServers {
+		result[server.ID] = make(map[string]string, len(server.Tags))
+		for _, tag := range server.Tags {
+			key, value, _ := strings.Cut(tag, "=")
+			result[server.ID][key] = value
+		}
+	}
+
+	return result, nil
+}
+
+// listResourceTags returns the tags of all resources of a type, keyed by
+// resource id, as listed by the resource_instances action of the service.
+func listResourceTags(client *golangsdk.ServiceClient, resourceType string) (map[string]map[string]string, error) {
+	url := client.ServiceURL(client.ProjectID, resourceType, "resource_instances", "action")
+	limit := 1000
+
+	result := make(map[string]map[string]string)
+	for offset := 0; ; {
+		var page struct {
+			Resources []struct {
+				ResourceID string             `json:"resource_id"`
+				Tags       []tags.ResourceTag `json:"tags"`
+			} `json:"resources"`
+			TotalCount int `json:"total_count"`
+		}
+
+		_, err := client.Post(url, map[string]string{
+			"action": "filter",
+			"limit":  strconv.Itoa(limit),
+			"offset": strconv.Itoa(offset),
+		}, &page, &golangsdk.RequestOpts{
+			OkCodes: []int{200},
+		})
+		if err != nil {
+			slog.Error(fmt.Sprintf("listing the tags of all %s failed: %s", resourceType, err.Error()))
+			return nil, err
+		}
+
+		for _, resource := range page.Resources {
+			result[resource.ResourceID] = make(map[string]string, len(resource.Tags))
+			for _, tag := range resource.Tags {
+				result[resource.ResourceID][tag.Key] = tag.Value
+			}
+		}
+
+		offset += len(page.Resources)
+		if len(page.Resources) == 0 || offset >= page.TotalCount {
+			return result, nil
+		}
+	}
+}
+
+// getResourceTags returns the tags of a resource.
+func getResourceTags(client *golangsdk.ServiceClient, resourceType string, id string) (map[string]string, error) {
+	resourceTags, err := tags.Get(client, resourceType, id).Extract()
+	if err != nil {
+		slog.Error(fmt.Sprintf("getting the tags of %s %s failed: %s", resourceType, id, err.Error()))
+		return nil, err
+	}
+
+	result := make(map[string]string, len(resourceTags.Tags))
+	for _, tag := range resourceTags.Tags {
+		result[tag.Key] = tag.Value
+	}
+
+	return result, nil
+}
@@ -0,0 +1,216 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/akyriako/cloudeye-exporter/config"
+	"github.com/huaweicloud/golangsdk"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeIAM issues tokens expiring after lifetime, with CES and VPC in their
+// catalog, and serves the other requests of the holders of the latest token
+// only, with services or an empty object.
+type fakeIAM struct {
+	lifetime time.Duration
+	services http.Handler
+	issued   int
+	sync.Mutex
+}
+
+func (f *fakeIAM) current() string {
+	return fmt.Sprintf("token-%d", f.issued)
+}
+
+func (f *fakeIAM) revoke() {
+	f.Lock()
+	defer f.Unlock()
+
+	f.issued++
+}
+
+func (f *fakeIAM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	expiresAt := time.Now().Add(f.lifetime).UTC().Format(time.RFC3339)
+	switch {
+	case r.URL.Path == "/v3/auth/tokens" && r.Method == http.MethodPost:
+		f.issued++
+		w.Header().Set("X-Subject-Token", f.current())
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprintf(w, `{"token": {"expires_at": %q, "catalog": [{"type": "cesv1", "endpoints": [{"interface": "public", "region": "eu-de", "url": "http://%[2]s/ces/v1/p"}]}, {"type": "vpc", "endpoints": [{"interface": "public", "region": "eu-de", "url": "http://%[2]s/vpc/"}]}], "project": {"id": "p", "domain": {"id": "d"}}}}`, expiresAt, r.Host)
+	case r.URL.Path == "/v3/auth/tokens" && r.Method == http.MethodGet:
+		_, _ = fmt.Fprintf(w, `{"token": {"expires_at": %q}}`, expiresAt)
+	case r.Header.Get("X-Auth-Token") != f.current():
+		w.WriteHeader(http.StatusUnauthorized)
+	case f.services != nil:
+		f.services.ServeHTTP(w, r)
+	default:
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
+func newTestClient(t *testing.T, iam *fakeIAM) (*OpenTelekomCloudClient, *httptest.Server) {
+	t.Helper()
+
+	server := httptest.NewServer(iam)
+	t.Cleanup(server.Close)
+
+	client, err := NewOpenTelekomCloudClient(config.CloudAuth{
+		AuthURL:    server.URL + "/v3",
+		ProjectID:  "p",
+		DomainName: "d",
+		UserName:   "u",
+		Password:   "pw",
+		Region:     "eu-de",
+	}, http.DefaultTransport)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client, server
+}
+
+func TestTokenRenewalTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		lifetime time.Duration
+		want     time.Duration
+	}{
+		{name: "day", lifetime: 24 * time.Hour, want: 23 * time.Hour},
+		{name: "short lived", lifetime: time.Hour, want: 30 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newTestClient(t, &fakeIAM{lifetime: tt.lifetime})
+
+			renewIn := time.Until(client.expiresAt)
+			if renewIn > tt.want || renewIn < tt.want-time.Minute {
+				t.Errorf("token renewed in %s, want %s ahead of the expiry reported by IAM", renewIn, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenewTokenIfExpired(t *testing.T) {
+	iam := &fakeIAM{lifetime: 24 * time.Hour}
+	client, _ := newTestClient(t, iam)
+
+	token := client.HwClient.Token()
+	if err := client.renewTokenIfExpired(); err != nil || client.HwClient.Token() != token {
+		t.Fatalf("renewTokenIfExpired() = %v, want the token kept before its renewal", err)
+	}
+
+	client.expiresAt = time.Now().Add(-time.Second)
+	if err := client.renewTokenIfExpired(); err != nil || client.HwClient.Token() == token {
+		t.Fatalf("renewTokenIfExpired() = %v, want the token renewed", err)
+	}
+	if time.Until(client.expiresAt) < 22*time.Hour {
+		t.Errorf("next renewal in %s, want it scheduled ahead of the new expiry", time.Until(client.expiresAt))
+	}
+}
+
+func TestWithContextReauthenticates(t *testing.T) {
+	iam := &fakeIAM{lifetime: 24 * time.Hour}
+	client, server := newTestClient(t, iam)
+	iam.revoke()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	copied := client.WithContext(ctx)
+	done := make(chan error, 1)
+	go func() {
+		_, err := copied.HwClient.Request(http.MethodGet, server.URL+"/resource", &golangsdk.RequestOpts{
+			OkCodes: []int{http.StatusOK},
+		})
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("request after a 401 failed: %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("request after a 401 did not return, reauthentication deadlocked")
+	}
+
+	if client.HwClient.Token() != copied.HwClient.Token() {
+		t.Errorf("pooled client token = %s, want the renewed token %s", client.HwClient.Token(), copied.HwClient.Token())
+	}
+}
+
+func TestWithContextCancels(t *testing.T) {
+	iam := &fakeIAM{lifetime: 24 * time.Hour}
+	client, _ := newTestClient(t, iam)
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.WithContext(ctx).HwClient.Request(http.MethodGet, slow.URL, &golangsdk.RequestOpts{
+		OkCodes: []int{http.StatusOK},
+	})
+	if err == nil || time.Since(start) > time.Second {
+		t.Errorf("request returned %v after %s, want it cancelled with the context", err, time.Since(start))
+	}
+
+	// the pooled client itself is not bound to the context
+	if client.HwClient.Context != nil {
+		t.Error("the context leaked into the pooled client")
+	}
+}
+
+func TestListResourceTags(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Method != http.MethodPost || r.URL.Path != "/p/loadbalancers/resource_instances/action" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		switch body["offset"] {
+		case "0":
+			_, _ = w.Write([]byte(`{"resources": [{"resource_id": "lb-1", "tags": [{"key": "team", "value": "a"}]}], "total_count": 2}`))
+		case "1":
+			_, _ = w.Write([]byte(`{"resources": [{"resource_id": "lb-2", "tags": []}], "total_count": 2}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	client := &golangsdk.ServiceClient{
+		ProviderClient: &golangsdk.ProviderClient{HTTPClient: *http.DefaultClient, ProjectID: "p"},
+		Endpoint:       server.URL + "/",
+	}
+
+	got, err := listResourceTags(client, "loadbalancers")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]map[string]string{"lb-1": {"team": "a"}, "lb-2": {}}
+	if !reflect.DeepEqual(got, want) || requests != 2 {
+		t.Errorf("listResourceTags() = %v in %d requests, want %v in 2 requests", got, requests, want)
+	}
+}
@@ -0,0 +1,224 @@
+package collector
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+// ContextCollector is a collector whose collection can be bound to a given
+// context instead of the one it was built with.
+type ContextCollector interface {
+	prometheus.Collector
+	CollectWithContext(ctx context.Context, ch chan<- prometheus.Metric)
+}
+
+type coalescedScrape struct {
+	ctx     *sharedContext
+	done    chan struct{}
+	metrics []prometheus.Metric
+}
+
+// ScrapeCoalescer lets identical scrapes share a single collection: a scrape
+// arriving while an identical one is in flight waits for its result, and with
+// a cache TTL the result is also served to identical scrapes arriving until the
+// TTL expires. Scrapes are identified by a key the caller derives from
+// account, namespaces and query options.
+//
+// A shared collection is not bound to any of the scrapes waiting on it, it is
+// only cut short once the latest timeout among them is exceeded, while every
+// scrape stops waiting once its own context is done.
+type ScrapeCoalescer struct {
+	cacheTTL time.Duration
+	inFlight map[string]*coalescedScrape
+	cache    map[string]*snapshot
+	sync.Mutex
+}
+
+func NewScrapeCoalescer(cacheTTL time.Duration) *ScrapeCoalescer {
+	return &ScrapeCoalescer{
+		cacheTTL: cacheTTL,
+		inFlight: make(map[string]*coalescedScrape),
+		cache:    make(map[string]*snapshot),
+	}
+}
+
+// Collector wraps collector, so that its collection is shared with all the
+// identical scrapes. The scrape waits for the collection until ctx is done,
+// and extends the collection to timeout, zero meaning no timeout.
+func (s *ScrapeCoalescer) Collector(ctx context.Context, timeout time.Duration, key string, collector ContextCollector) prometheus.Collector {
+	return &coalescedCollector{
+		coalescer: s,
+		ctx:       ctx,
+		timeout:   timeout,
+		key:       key,
+		collector: collector,
+	}
+}
+
+func (s *ScrapeCoalescer) collect(ctx context.Context, timeout time.Duration, key string, collector ContextCollector) []prometheus.Metric {
+	s.Lock()
+	if cached, ok := s.cache[key]; ok && time.Since(cached.CollectedAt) < s.cacheTTL {
+		s.Unlock()
+		return cached.Metrics
+	}
+
+	scrape, ok := s.inFlight[key]
+	if ok {
+		scrape.ctx.extend(timeout)
+	} else {
+		scrape = &coalescedScrape{
+			ctx:  newSharedContext(context.WithoutCancel(ctx), timeout),
+			done: make(chan struct{}),
+		}
+		s.inFlight[key] = scrape
+		go s.run(key, scrape, collector)
+	}
+	s.Unlock()
+
+	select {
+	case <-scrape.done:
+		return scrape.metrics
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// run collects a shared scrape and caches its result, unless the collection
+// was cut short.
+func (s *ScrapeCoalescer) run(key string, scrape *coalescedScrape, collector ContextCollector) {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		collector.CollectWithContext(scrape.ctx, ch)
+		close(ch)
+	}()
+
+	metrics := make([]prometheus.Metric, 0)
+	for metric := range ch {
+		metrics = append(metrics, metric)
+	}
+	scrape.metrics = metrics
+	close(scrape.done)
+
+	s.Lock()
+	delete(s.inFlight, key)
+	if s.cacheTTL > 0 && scrape.ctx.Err() == nil {
+		s.evictExpired()
+		s.cache[key] = &snapshot{
+			Metrics:     scrape.metrics,
+			CollectedAt: time.Now(),
+		}
+	}
+	s.Unlock()
+}
+
+// evictExpired drops the expired results from the cache. The caller must hold
+// the lock.
+func (s *ScrapeCoalescer) evictExpired() {
+	for key, cached := range s.cache {
+		if time.Since(cached.CollectedAt) >= s.cacheTTL {
+			delete(s.cache, key)
+		}
+	}
+}
+
+type coalescedCollector struct {
+	coalescer *ScrapeCoalescer
+	ctx       context.Context
+	timeout   time.Duration
+	key       string
+	collector ContextCollector
+}
+
+func (c *coalescedCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.collector.Describe(ch)
+}
+
+func (c *coalescedCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, metric := range c.coalescer.collect(c.ctx, c.timeout, c.key, c.collector) {
+		ch <- metric
+	}
+}
+
+// sharedContext is the context of a shared collection. It carries the values
+// of the scrape starting the collection but none of its cancellation, and is
+// done once its deadline, which the scrapes joining the collection extend, is
+// exceeded.
+type sharedContext struct {
+	context.Context
+	done      chan struct{}
+	err       error
+	deadline  time.Time
+	unbounded bool
+	timer     *time.Timer
+	sync.Mutex
+}
+
+func newSharedContext(parent context.Context, timeout time.Duration) *sharedContext {
+	ctx := &sharedContext{
+		Context:   parent,
+		done:      make(chan struct{}),
+		unbounded: timeout <= 0,
+	}
+	if !ctx.unbounded {
+		ctx.deadline = time.Now().Add(timeout)
+		ctx.timer = time.AfterFunc(timeout, ctx.expire)
+	}
+
+	return ctx
+}
+
+// extend moves the deadline to timeout from now, if that is later, a zero
+// timeout lifts the deadline. A context already done stays done.
+func (c *sharedContext) extend(timeout time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.err != nil || c.unbounded {
+		return
+	}
+
+	if timeout <= 0 {
+		c.unbounded = true
+		c.timer.Stop()
+		return
+	}
+
+	deadline := time.Now().Add(timeout)
+	if deadline.After(c.deadline) {
+		c.deadline = deadline
+		c.timer.Reset(timeout)
+	}
+}
+
+func (c *sharedContext) expire() {
+	c.Lock()
+	defer c.Unlock()
+
+	// the timer may fire right before being reset to a later deadline
+	if c.err != nil || c.unbounded || time.Now().Before(c.deadline) {
+		return
+	}
+
+	c.err = context.DeadlineExceeded
+	close(c.done)
+}
+
+func (c *sharedContext) Deadline() (time.Time, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.deadline, !c.unbounded
+}
+
+func (c *sharedContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *sharedContext) Err() error {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.err
+}
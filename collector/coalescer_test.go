@@ -0,0 +1,228 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testDesc = prometheus.NewDesc("test_metric", "A metric of the tests.", nil, nil)
+
+// blockingCollector emits a single metric once released, or once its context
+// is done, valued 1 for a completed collection and 0 for a cut short one.
+type blockingCollector struct {
+	release     chan struct{}
+	collections atomic.Int32
+}
+
+func newBlockingCollector() *blockingCollector {
+	return &blockingCollector{release: make(chan struct{})}
+}
+
+func (b *blockingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- testDesc
+}
+
+func (b *blockingCollector) Collect(ch chan<- prometheus.Metric) {
+	b.CollectWithContext(context.Background(), ch)
+}
+
+func (b *blockingCollector) CollectWithContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	b.collections.Add(1)
+
+	value := 1.0
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+		value = 0
+	}
+
+	ch <- prometheus.MustNewConstMetric(testDesc, prometheus.GaugeValue, value)
+}
+
+type collectResult struct {
+	metrics []prometheus.Metric
+}
+
+func collectAsync(coalescer *ScrapeCoalescer, ctx context.Context, timeout time.Duration, collector ContextCollector) chan collectResult {
+	result := make(chan collectResult, 1)
+	go func() {
+		result <- collectResult{metrics: collectAll(coalescer.Collector(ctx, timeout, "key", collector))}
+	}()
+
+	return result
+}
+
+func waitForCollections(t *testing.T, collector *blockingCollector, collections int32) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for collector.collections.Load() < collections {
+		if time.Now().After(deadline) {
+			t.Fatalf("collections = %d, want %d", collector.collections.Load(), collections)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func getValue(t *testing.T, metrics []prometheus.Metric) float64 {
+	t.Helper()
+
+	if len(metrics) != 1 {
+		t.Fatalf("got %d metrics, want 1", len(metrics))
+	}
+
+	value, err := metricValue(metrics[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return value
+}
+
+func TestScrapeCoalescerSharesCollection(t *testing.T) {
+	coalescer := NewScrapeCoalescer(time.Minute)
+	collector := newBlockingCollector()
+
+	first := collectAsync(coalescer, context.Background(), 0, collector)
+	waitForCollections(t, collector, 1)
+	second := collectAsync(coalescer, context.Background(), 0, collector)
+	time.Sleep(10 * time.Millisecond)
+	close(collector.release)
+
+	for _, result := range []chan collectResult{first, second} {
+		if value := getValue(t, (<-result).metrics); value != 1 {
+			t.Errorf("value = %v, want 1", value)
+		}
+	}
+
+	// served from the cache
+	cached := <-collectAsync(coalescer, context.Background(), 0, collector)
+	if value := getValue(t, cached.metrics); value != 1 {
+		t.Errorf("cached value = %v, want 1", value)
+	}
+
+	if collections := collector.collections.Load(); collections != 1 {
+		t.Errorf("collections = %d, want 1", collections)
+	}
+}
+
+func TestScrapeCoalescerFirstScrapeCancelled(t *testing.T) {
+	coalescer := NewScrapeCoalescer(time.Minute)
+	collector := newBlockingCollector()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := collectAsync(coalescer, ctx, 0, collector)
+	waitForCollections(t, collector, 1)
+	second := collectAsync(coalescer, context.Background(), 0, collector)
+
+	cancel()
+	if metrics := (<-first).metrics; len(metrics) != 0 {
+		t.Errorf("cancelled scrape got %d metrics, want none", len(metrics))
+	}
+
+	close(collector.release)
+	if value := getValue(t, (<-second).metrics); value != 1 {
+		t.Errorf("value = %v, want the completed collection", value)
+	}
+}
+
+func TestScrapeCoalescerWaiterCancelled(t *testing.T) {
+	coalescer := NewScrapeCoalescer(0)
+	collector := newBlockingCollector()
+	defer close(collector.release)
+
+	first := collectAsync(coalescer, context.Background(), 0, collector)
+	waitForCollections(t, collector, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	select {
+	case result := <-collectAsync(coalescer, ctx, 0, collector):
+		if len(result.metrics) != 0 {
+			t.Errorf("cancelled waiter got %d metrics, want none", len(result.metrics))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter did not stop waiting once its context was done")
+	}
+
+	select {
+	case <-first:
+		t.Fatal("the collection ended with the waiter")
+	default:
+	}
+}
+
+func TestScrapeCoalescerTimeoutNotCached(t *testing.T) {
+	coalescer := NewScrapeCoalescer(time.Minute)
+	collector := newBlockingCollector()
+
+	result := <-collectAsync(coalescer, context.Background(), 10*time.Millisecond, collector)
+	if value := getValue(t, result.metrics); value != 0 {
+		t.Errorf("value = %v, want the cut short collection", value)
+	}
+
+	close(collector.release)
+	result = <-collectAsync(coalescer, context.Background(), 0, collector)
+	if value := getValue(t, result.metrics); value != 1 {
+		t.Errorf("value = %v, want a new collection", value)
+	}
+	if collections := collector.collections.Load(); collections != 2 {
+		t.Errorf("collections = %d, want 2", collections)
+	}
+}
+
+func TestScrapeCoalescerExtendsTimeout(t *testing.T) {
+	coalescer := NewScrapeCoalescer(0)
+	collector := newBlockingCollector()
+
+	first := collectAsync(coalescer, context.Background(), 20*time.Millisecond, collector)
+	waitForCollections(t, collector, 1)
+	second := collectAsync(coalescer, context.Background(), time.Minute, collector)
+	time.Sleep(50 * time.Millisecond)
+	close(collector.release)
+
+	for _, result := range []chan collectResult{first, second} {
+		if value := getValue(t, (<-result).metrics); value != 1 {
+			t.Errorf("value = %v, want the collection extended to the longest timeout", value)
+		}
+	}
+}
+
+func TestSharedContext(t *testing.T) {
+	ctx := newSharedContext(context.Background(), 10*time.Millisecond)
+	if _, ok := ctx.Deadline(); !ok {
+		t.Error("deadline not set")
+	}
+
+	ctx.extend(time.Hour)
+	time.Sleep(20 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatalf("err = %v before the extended deadline", ctx.Err())
+	}
+
+	ctx.extend(0)
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("deadline not lifted")
+	}
+
+	expiring := newSharedContext(context.Background(), time.Millisecond)
+	<-expiring.Done()
+	if !errors.Is(expiring.Err(), context.DeadlineExceeded) {
+		t.Errorf("err = %v, want %v", expiring.Err(), context.DeadlineExceeded)
+	}
+}
+
+func metricValue(metric prometheus.Metric) (float64, error) {
+	var m dto.Metric
+	err := metric.Write(&m)
+	if err != nil {
+		return 0, err
+	}
+
+	return m.GetGauge().GetValue(), nil
+}
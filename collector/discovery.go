@@ -0,0 +1,184 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"github.com/akyriako/cloudeye-exporter/config"
+	"github.com/huaweicloud/golangsdk/openstack/ces/v1/metrics"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+type discoveredNamespaces struct {
+	Namespaces   []string
+	DiscoveredAt time.Time
+}
+
+// namespaceListing is a listing of the metrics of an account in flight, which
+// the scrapes of the account arriving meanwhile wait for.
+type namespaceListing struct {
+	done       chan struct{}
+	discovered *discoveredNamespaces
+	err        error
+}
+
+// NamespaceDiscovery finds the namespaces that hold metrics of an account by
+// listing all of its metrics in CES, including the namespaces without a
+// provider, e.g. custom ones. The namespaces are listed again once they are
+// older than the refresh interval of the discovery configuration, at most once
+// at a time per account.
+type NamespaceDiscovery struct {
+	cloudConfig *config.CloudConfig
+	clientPool  *ClientPool
+	discovered  map[string]*discoveredNamespaces
+	inFlight    map[string]*namespaceListing
+	sync.Mutex
+}
+
+func NewNamespaceDiscovery(cloudConfig *config.CloudConfig, clientPool *ClientPool) *NamespaceDiscovery {
+	return &NamespaceDiscovery{
+		cloudConfig: cloudConfig,
+		clientPool:  clientPool,
+		discovered:  make(map[string]*discoveredNamespaces),
+		inFlight:    make(map[string]*namespaceListing),
+	}
+}
+
+// Reload returns the discovery of a reloaded configuration, keeping the
+// namespaces discovered for the accounts whose credentials did not change.
+func (d *NamespaceDiscovery) Reload(cloudConfig *config.CloudConfig, clientPool *ClientPool) *NamespaceDiscovery {
+	d.Lock()
+	defer d.Unlock()
+
+	discovery := NewNamespaceDiscovery(cloudConfig, clientPool)
+	for _, account := range cloudConfig.Accounts {
+		previous, err := d.cloudConfig.GetAccount(account.Name)
+		if err != nil || getClientPoolKey(previous.Auth) != getClientPoolKey(account.Auth) {
+			continue
+		}
+		if discovered, ok := d.discovered[account.Name]; ok {
+			discovery.discovered[account.Name] = discovered
+		}
+	}
+
+	return discovery
+}
+
+// Namespaces returns the discovered namespaces of an account that match the
+// include and exclude patterns of the discovery configuration. A scrape
+// arriving while the metrics of the account are listed waits for that listing
+// until ctx is done.
+func (d *NamespaceDiscovery) Namespaces(ctx context.Context, account *config.Account) ([]string, error) {
+	d.Lock()
+	discovered, ok := d.discovered[account.Name]
+	if ok && time.Since(discovered.DiscoveredAt) <= d.cloudConfig.Global.Discovery.RefreshInterval {
+		d.Unlock()
+		return d.matching(discovered), nil
+	}
+
+	listing, inFlight := d.inFlight[account.Name]
+	if !inFlight {
+		listing = &namespaceListing{done: make(chan struct{})}
+		d.inFlight[account.Name] = listing
+	}
+	d.Unlock()
+
+	if inFlight {
+		select {
+		case <-listing.done:
+		case <-ctx.Done():
+			return d.fallback(account, discovered, ok, ctx.Err())
+		}
+	} else {
+		d.list(ctx, account, listing)
+	}
+
+	if listing.err != nil {
+		return d.fallback(account, discovered, ok, listing.err)
+	}
+
+	return d.matching(listing.discovered), nil
+}
+
+// list lists the metrics of an account, stores the namespaces found and
+// releases the scrapes waiting for the listing.
+func (d *NamespaceDiscovery) list(ctx context.Context, account *config.Account, listing *namespaceListing) {
+	defer close(listing.done)
+
+	namespaces, err := d.discover(ctx, account)
+
+	d.Lock()
+	defer d.Unlock()
+
+	delete(d.inFlight, account.Name)
+	if err != nil {
+		listing.err = err
+		return
+	}
+
+	listing.discovered = &discoveredNamespaces{
+		Namespaces:   namespaces,
+		DiscoveredAt: time.Now(),
+	}
+	d.discovered[account.Name] = listing.discovered
+}
+
+// fallback serves the previously discovered namespaces of an account when
+// discovering them again failed, if there are any.
+func (d *NamespaceDiscovery) fallback(account *config.Account, discovered *discoveredNamespaces, ok bool, err error) ([]string, error) {
+	if !ok {
+		return nil, err
+	}
+
+	slog.Error(fmt.Sprintf("discovering the namespaces of account %s failed, serving the previous ones: %s", account.Name, err.Error()))
+	return d.matching(discovered), nil
+}
+
+func (d *NamespaceDiscovery) matching(discovered *discoveredNamespaces) []string {
+	matching := make([]string, 0, len(discovered.Namespaces))
+	for _, namespace := range discovered.Namespaces {
+		if d.cloudConfig.Global.Discovery.Matches(namespace) {
+			matching = append(matching, namespace)
+		}
+	}
+
+	return matching
+}
+
+func (d *NamespaceDiscovery) discover(ctx context.Context, account *config.Account) ([]string, error) {
+	pooledClient, err := d.clientPool.Get(account.Auth)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := pooledClient.WithContext(ctx).GetCESClient()
+	if err != nil {
+		return nil, err
+	}
+
+	limit := 1000
+	allPages, err := metrics.List(client, metrics.ListOpts{Limit: &limit}).AllPages()
+	if err != nil {
+		slog.Error(fmt.Sprintf("getting all metrics pages failed: %s", err.Error()))
+		return nil, err
+	}
+
+	v, err := metrics.ExtractAllPagesMetrics(allPages)
+	if err != nil {
+		slog.Error(fmt.Sprintf("extracting all metrics pages failed: %s", err.Error()))
+		return nil, err
+	}
+
+	namespaces := make([]string, 0)
+	for _, metric := range v.Metrics {
+		if !slices.Contains(namespaces, metric.Namespace) {
+			namespaces = append(namespaces, metric.Namespace)
+		}
+	}
+	slices.Sort(namespaces)
+
+	slog.Info(fmt.Sprintf("discovered %d namespaces of account %s: %v", len(namespaces), account.Name, namespaces))
+	return namespaces, nil
+}
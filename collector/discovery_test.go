@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"context"
+	"github.com/akyriako/cloudeye-exporter/config"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNamespaceDiscoveryPerAccount(t *testing.T) {
+	iam := &fakeIAM{lifetime: 24 * time.Hour}
+	release := make(chan struct{})
+	var listings atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/ces/") {
+			iam.ServeHTTP(w, r)
+			return
+		}
+
+		// the first listing hangs until released
+		if listings.Add(1) == 1 {
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"metrics": [{"namespace": "SYS.ECS", "metric_name": "cpu_util"}], "meta_data": {"count": 1}}`))
+	}))
+	defer server.Close()
+	defer close(release)
+
+	newAccount := func(name string) config.Account {
+		return config.Account{Name: name, Auth: config.CloudAuth{
+			AuthURL:    server.URL + "/v3",
+			ProjectID:  name,
+			DomainName: "d",
+			UserName:   "u",
+			Password:   "pw",
+			Region:     "eu-de",
+		}}
+	}
+	production, staging := newAccount("production"), newAccount("staging")
+
+	cloudConfig := newTestConfig(production, staging)
+	cloudConfig.Global.Discovery.RefreshInterval = time.Hour
+	discovery := NewNamespaceDiscovery(cloudConfig, NewClientPool(cloudConfig))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	discover := func(ctx context.Context, account config.Account) chan []string {
+		result := make(chan []string, 1)
+		go func() {
+			namespaces, _ := discovery.Namespaces(ctx, &account)
+			result <- namespaces
+		}()
+		return result
+	}
+
+	first := discover(ctx, production)
+	for listings.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	second := discover(ctx, production)
+
+	select {
+	case namespaces := <-discover(ctx, staging):
+		if !slices.Equal(namespaces, []string{"SYS.ECS"}) {
+			t.Errorf("namespaces of staging = %v, want [SYS.ECS]", namespaces)
+		}
+	case <-ctx.Done():
+		t.Fatal("discovering staging waited for the listing of production")
+	}
+
+	waiting, stop := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer stop()
+	if namespaces, err := discovery.Namespaces(waiting, &production); err == nil {
+		t.Errorf("Namespaces() = %v, want an error once the context of a waiting scrape is done", namespaces)
+	}
+
+	release <- struct{}{}
+	for _, result := range []chan []string{first, second} {
+		if namespaces := <-result; !slices.Equal(namespaces, []string{"SYS.ECS"}) {
+			t.Errorf("namespaces of production = %v, want [SYS.ECS]", namespaces)
+		}
+	}
+	if listings.Load() != 2 {
+		t.Errorf("metrics listed %d times, want once per account", listings.Load())
+	}
+}
@@ -0,0 +1,47 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Reasons a namespace collection failed with, they are exported as the reason
+// label of the namespace_up metric and have to be kept low in cardinality.
+const (
+	reasonClient        = "client"
+	reasonListMetrics   = "list_metrics"
+	reasonListResources = "list_resources"
+	reasonBatchQuery    = "batch_query"
+	reasonTimeout       = "timeout"
+	reasonPanic         = "panic"
+	reasonUnknown       = "unknown"
+)
+
+type namespaceError struct {
+	Reason string
+	Err    error
+}
+
+func newNamespaceError(reason string, err error) *namespaceError {
+	return &namespaceError{
+		Reason: reason,
+		Err:    err,
+	}
+}
+
+func (e *namespaceError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Reason, e.Err.Error())
+}
+
+func (e *namespaceError) Unwrap() error {
+	return e.Err
+}
+
+func getErrorReason(err error) string {
+	var nsErr *namespaceError
+	if errors.As(err, &nsErr) {
+		return nsErr.Reason
+	}
+
+	return reasonUnknown
+}
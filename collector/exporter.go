@@ -6,7 +6,6 @@ import (
 	"github.com/akyriako/cloudeye-exporter/config"
 	"github.com/prometheus/client_golang/prometheus"
 	"log/slog"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -14,28 +13,46 @@ import (
 
 type CloudEyeExporter struct {
 	sync.RWMutex
-	From            string
-	To              string
+	CloudConfig     *config.CloudConfig
+	QueryOverrides  config.QueryOptions
 	Namespaces      []string
 	Prefix          string
 	Client          *OpenTelekomCloudClient
+	Timeout         time.Duration
+	Account         string
+	Project         string
 	Region          string
 	txnKey          string
+	now             time.Time
+	ctx             context.Context
+	pooledClient    *OpenTelekomCloudClient
+	resourceCache   *ResourceCache
 	MaxRoutines     int
 	ScrapeBatchSize int
 }
 
-func NewCloudEyeExporter(cloudConfig *config.CloudConfig, namespaces []string) (*CloudEyeExporter, error) {
-	client, err := NewOpenTelekomCloudClient(cloudConfig)
+// NewCloudEyeExporter returns an exporter collecting the given namespaces of an
+// account. Collections are bound to ctx and, if a Timeout is set, cancelled
+// once it is exceeded, serving whatever was collected until then.
+func NewCloudEyeExporter(ctx context.Context, cloudConfig *config.CloudConfig, clientPool *ClientPool, account *config.Account, namespaces []string) (*CloudEyeExporter, error) {
+	client, err := clientPool.Get(account.Auth)
 	if err != nil {
 		return nil, err
 	}
 
+	constLabels := getConstLabels(account)
 	cloudEyeExporter := &CloudEyeExporter{
+		CloudConfig:     cloudConfig,
 		Namespaces:      namespaces,
 		Prefix:          cloudConfig.Global.Prefix,
 		MaxRoutines:     cloudConfig.Global.MaxRoutines,
 		Client:          client,
+		ctx:             ctx,
+		pooledClient:    client,
+		resourceCache:   clientPool.ResourceCache(),
+		Account:         constLabels["account"],
+		Project:         constLabels["project"],
+		Region:          constLabels["region"],
 		ScrapeBatchSize: cloudConfig.Global.ScrapeBatchSize,
 	}
 
@@ -50,21 +67,24 @@ func (c *CloudEyeExporter) Describe(ch chan<- *prometheus.Desc) {
 }
 
 func (c *CloudEyeExporter) Collect(ch chan<- prometheus.Metric) {
-	c.Lock()
-	defer c.Unlock()
-
-	duration, err := time.ParseDuration("-10m")
-	if err != nil {
-		slog.Error(fmt.Sprintf("parse duration -10m error: %s", err.Error()))
-		return
+	ctx, cancel := context.WithCancel(c.ctx)
+	if c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(c.ctx, c.Timeout)
 	}
-	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	now := time.Now()
-	c.From = strconv.FormatInt(now.Add(duration).UnixNano()/1e6, 10)
-	c.To = strconv.FormatInt(now.UnixNano()/1e6, 10)
-	c.txnKey = fmt.Sprintf("%s-%s-%s", strings.Join(c.Namespaces, "-"), c.From, c.To)
+	c.CollectWithContext(ctx, ch)
+}
+
+// CollectWithContext collects on ctx, instead of the context and the timeout
+// the exporter was built with.
+func (c *CloudEyeExporter) CollectWithContext(ctx context.Context, ch chan<- prometheus.Metric) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.Client = c.pooledClient.WithContext(ctx)
+	c.now = time.Now()
+	c.txnKey = fmt.Sprintf("%s-%s-%d", c.Account, strings.Join(c.Namespaces, "-"), c.now.UnixMilli())
 
 	slog.Debug(fmt.Sprintf("[%s] start collecting data", c.txnKey))
 	var wg sync.WaitGroup
@@ -72,9 +92,96 @@ func (c *CloudEyeExporter) Collect(ch chan<- prometheus.Metric) {
 		wg.Add(1)
 		go func(ctx context.Context, ch chan<- prometheus.Metric, namespace string) {
 			defer wg.Done()
-			c.collectMetricsByNamespace(ctx, ch, namespace)
+			c.collectAndObserveNamespace(ctx, ch, namespace)
 		}(ctx, ch, namespace)
 	}
 	wg.Wait()
 	slog.Debug(fmt.Sprintf("[%s] end collecting data", c.txnKey))
 }
+
+// collectAndObserveNamespace collects a namespace and records its duration,
+// outcome and number of emitted series.
+func (c *CloudEyeExporter) collectAndObserveNamespace(ctx context.Context, ch chan<- prometheus.Metric, namespace string) {
+	start := time.Now()
+	series := 0
+
+	namespaceCh := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for metric := range namespaceCh {
+			series++
+			ch <- metric
+		}
+	}()
+
+	err := c.collectMetricsByNamespace(ctx, namespaceCh, namespace)
+	close(namespaceCh)
+	<-done
+
+	if err != nil {
+		slog.Error(fmt.Sprintf("[%s] collecting %s failed: %s", c.txnKey, namespace, err.Error()))
+	}
+	observeNamespaceScrape(c.Account, namespace, time.Since(start), series, err)
+
+	c.pushNamespaceUp(ctx, ch, namespace, err)
+}
+
+// pushNamespaceUp reports the outcome of the collection of a namespace. With
+// the fail error policy, a failed collection fails the whole scrape through an
+// invalid metric.
+func (c *CloudEyeExporter) pushNamespaceUp(ctx context.Context, ch chan<- prometheus.Metric, namespace string, err error) {
+	metric := newNamespaceUpMetric(c.CloudConfig.Global, c.constLabels(), namespace, err)
+	if err := pushMetricData(ctx, ch, metric); err != nil {
+		slog.Error(fmt.Sprintf("[%s] context cancellation detected while push metric: namespace_up of %s", c.txnKey, namespace))
+	}
+}
+
+func newNamespaceUpMetric(global config.Global, constLabels prometheus.Labels, namespace string, err error) prometheus.Metric {
+	fqName := prometheus.BuildFQName(global.Prefix, "", "namespace_up")
+	desc := prometheus.NewDesc(fqName, "Whether the last collection of a namespace succeeded, with the reason of the failure otherwise.", []string{"namespace", "reason"}, constLabels)
+
+	switch {
+	case err == nil:
+		return prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 1, namespace, "")
+	case global.ErrorPolicy == config.ErrorPolicyFail:
+		return prometheus.NewInvalidMetric(desc, fmt.Errorf("collecting %s failed: %w", namespace, err))
+	default:
+		return prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, 0, namespace, getErrorReason(err))
+	}
+}
+
+// tagLabelNames returns the names of the tag labels of the metrics of a
+// namespace, none if its provider does not read the tags of its resources.
+func (c *CloudEyeExporter) tagLabelNames(namespace string) []string {
+	if !providesTags(namespace) {
+		return nil
+	}
+
+	return c.CloudConfig.Global.TagLabels.LabelNames()
+}
+
+// constLabels are the labels identifying the account every series of this
+// exporter originates from.
+func (c *CloudEyeExporter) constLabels() prometheus.Labels {
+	return prometheus.Labels{
+		"account": c.Account,
+		"project": c.Project,
+		"region":  c.Region,
+	}
+}
+
+// getConstLabels returns the labels identifying an account, its project being
+// given by name or, failing that, by id.
+func getConstLabels(account *config.Account) prometheus.Labels {
+	project := account.Auth.ProjectName
+	if project == "" {
+		project = account.Auth.ProjectID
+	}
+
+	return prometheus.Labels{
+		"account": account.Name,
+		"project": project,
+		"region":  account.Auth.Region,
+	}
+}
@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"github.com/akyriako/cloudeye-exporter/config"
+	"github.com/huaweicloud/golangsdk"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listingProvider lists no resources, or fails to list them with err, once
+// release is closed, if given.
+type listingProvider struct {
+	namespace string
+	err       error
+	release   chan struct{}
+}
+
+func (p *listingProvider) Namespace() string {
+	return p.namespace
+}
+
+func (p *listingProvider) ServiceClient(client *OpenTelekomCloudClient) (*golangsdk.ServiceClient, error) {
+	return client.GetCESClient()
+}
+
+func (p *listingProvider) ExtensionLabels() map[string][]string {
+	return nil
+}
+
+func (p *listingProvider) Resources(client *OpenTelekomCloudClient, options ResourceOptions) (*Resources, error) {
+	if p.release != nil {
+		<-p.release
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	return newResources(), nil
+}
+
+func TestErrorPolicy(t *testing.T) {
+	RegisterNamespaceProvider(&listingProvider{namespace: "CUSTOM_NS.listed"})
+	RegisterNamespaceProvider(&listingProvider{namespace: "CUSTOM_NS.unlisted", err: errors.New("listing failed")})
+
+	iam := &fakeIAM{
+		lifetime: 24 * time.Hour,
+		services: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"metrics": [], "meta_data": {"count": 0}}`))
+		}),
+	}
+	client, _ := newTestClient(t, iam)
+
+	tests := []struct {
+		namespace  string
+		policy     string
+		wantStatus int
+		wantUp     string
+	}{
+		{namespace: "CUSTOM_NS.listed", policy: config.ErrorPolicyPartial, wantStatus: http.StatusOK, wantUp: `reason="",region=""} 1`},
+		{namespace: "CUSTOM_NS.listed", policy: config.ErrorPolicyFail, wantStatus: http.StatusOK, wantUp: `reason="",region=""} 1`},
+		{namespace: "CUSTOM_NS.unlisted", policy: config.ErrorPolicyPartial, wantStatus: http.StatusOK, wantUp: `reason="list_resources",region=""} 0`},
+		{namespace: "CUSTOM_NS.unlisted", policy: config.ErrorPolicyFail, wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.namespace+" "+tt.policy, func(t *testing.T) {
+			exporter := &CloudEyeExporter{
+				CloudConfig:   &config.CloudConfig{Global: config.Global{Prefix: "opentelekomcloud", ErrorPolicy: tt.policy}},
+				Namespaces:    []string{tt.namespace},
+				Prefix:        "opentelekomcloud",
+				Account:       "production",
+				ctx:           context.Background(),
+				pooledClient:  client,
+				resourceCache: NewResourceCache(),
+			}
+
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(exporter)
+			recorder := httptest.NewRecorder()
+			promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status code = %d, want %d: %s", recorder.Code, tt.wantStatus, recorder.Body.String())
+			}
+			if tt.wantUp != "" && !strings.Contains(recorder.Body.String(), tt.wantUp) {
+				t.Errorf("body = %s, want namespace_up with %s", recorder.Body.String(), tt.wantUp)
+			}
+		})
+	}
+}
+
+func TestCollectTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	RegisterNamespaceProvider(&listingProvider{namespace: "CUSTOM_NS.slow", release: release})
+
+	client, _ := newTestClient(t, &fakeIAM{lifetime: 24 * time.Hour})
+	exporter := &CloudEyeExporter{
+		CloudConfig:   &config.CloudConfig{Global: config.Global{Prefix: "opentelekomcloud"}},
+		Namespaces:    []string{"CUSTOM_NS.slow"},
+		Prefix:        "opentelekomcloud",
+		Account:       "production",
+		Timeout:       20 * time.Millisecond,
+		ctx:           context.Background(),
+		pooledClient:  client,
+		resourceCache: NewResourceCache(),
+	}
+
+	start := time.Now()
+	metrics := collectAll(exporter)
+	if time.Since(start) > time.Second {
+		t.Errorf("collection took %s, want it cut short at the timeout", time.Since(start))
+	}
+	if len(metrics) != 1 {
+		t.Fatalf("got %d metrics, want namespace_up only", len(metrics))
+	}
+	if up, _ := metricValue(metrics[0]); up != 0 || getLabels(t, metrics[0])["reason"] != reasonTimeout {
+		t.Errorf("namespace_up = %v with labels %v, want 0 with the %s reason", up, getLabels(t, metrics[0]), reasonTimeout)
+	}
+}
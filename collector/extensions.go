@@ -2,111 +2,96 @@ package collector
 
 import (
 	"fmt"
-	"github.com/akyriako/cloudeye-exporter/config"
+	"github.com/huaweicloud/golangsdk"
 	"log/slog"
 	"strings"
-	"sync"
-	"time"
 
 	"github.com/huaweicloud/golangsdk/openstack/ces/v1/metrics"
 	"github.com/huaweicloud/golangsdk/openstack/networking/v2/extensions/lbaas_v2/loadbalancers"
 )
 
 // If the extension labels have to added in this exporter, you only have
-// to add the code to the following two parts.
-// 1. Added the new labels name to defaultExtensionLabels
-// 2. Added the new labels values to getAllResources
-var defaultExtensionLabels = map[string][]string{
-	"sys_elb":                 []string{"name", "provider", "vip_address"},
-	"sys_elb_listener":        []string{"name", "port"},
-	"sys_nat":                 []string{"name"},
-	"sys_rds":                 []string{"name"},
-	"sys_rds_instance":        []string{"port", "name", "role"},
-	"sys_dcs":                 []string{"ip", "port", "name", "engine"},
-	"sys_dms":                 []string{"name"},
-	"sys_dms_instance":        []string{"name", "engine_version", "resource_spec_code", "connect_address", "port"},
-	"sys_dms_instance_broker": []string{"name", "engine_version", "resource_spec_code", "connect_address", "port"},
-	"sys_dms_instance_topics": []string{"name", "engine_version", "resource_spec_code", "connect_address", "port"},
-	"sys_vpc_bandwidth":       []string{"name", "size", "share_type", "bandwidth_type", "charge_mode"},
-	"sys_vpc_eip":             []string{"name", "public_ip_address", "type"},
-	"sys_evs":                 []string{"name", "server_id", "device"},
-	"sys_ecs":                 []string{"hostname"},
-	"sys_as":                  []string{"name", "status"},
-	"sys_functiongraph":       []string{"func_urn"},
-}
-
-const TTL = time.Hour * 3
-
-type serversInfo struct {
-	TTL           int64
-	LenMetric     int
-	Info          map[string][]string
-	FilterMetrics []metrics.Metric
-	sync.Mutex
-}
-
-var (
-	elbInfo serversInfo
-	natInfo serversInfo
-	rdsInfo serversInfo
-	dmsInfo serversInfo
-	dcsInfo serversInfo
-	vpcInfo serversInfo
-	evsInfo serversInfo
-	ecsInfo serversInfo
-	asInfo  serversInfo
-	fgsInfo serversInfo
-)
+// to add the code to the provider of the namespace.
+// 1. Added the new labels name to its ExtensionLabels
+// 2. Added the new labels values to its Resources
+func init() {
+	RegisterNamespaceProvider(&elbProvider{})
+	RegisterNamespaceProvider(&natProvider{})
+	RegisterNamespaceProvider(&rdsProvider{})
+	RegisterNamespaceProvider(&dmsProvider{})
+	RegisterNamespaceProvider(&dcsProvider{})
+	RegisterNamespaceProvider(&vpcProvider{})
+	RegisterNamespaceProvider(&evsProvider{})
+	RegisterNamespaceProvider(&ecsProvider{})
+	RegisterNamespaceProvider(&asProvider{})
+	RegisterNamespaceProvider(&fgsProvider{})
+}
 
-func (c *CloudEyeExporter) getELBResourceInfo() (map[string][]string, *[]metrics.Metric) {
-	resourceInfos := make(map[string][]string)
-	filterMetrics := make([]metrics.Metric, 0)
-	elbInfo.Lock()
-	defer elbInfo.Unlock()
-	if elbInfo.Info == nil || time.Now().Unix() > elbInfo.TTL {
-		allELBs, err := c.Client.getAllLoadBalancers()
+type elbProvider struct{}
+
+func (p *elbProvider) Namespace() string {
+	return "SYS.ELB"
+}
+
+func (p *elbProvider) ServiceClient(client *OpenTelekomCloudClient) (*golangsdk.ServiceClient, error) {
+	return client.GetELBClient()
+}
+
+func (p *elbProvider) ExtensionLabels() map[string][]string {
+	return map[string][]string{
+		"sys_elb":          {"name", "provider", "vip_address"},
+		"sys_elb_listener": {"name", "port"},
+	}
+}
+
+func (p *elbProvider) Tagged() bool {
+	return true
+}
+
+func (p *elbProvider) Resources(client *OpenTelekomCloudClient, options ResourceOptions) (*Resources, error) {
+	resources := newResources()
+	allELBs, err := client.getAllLoadBalancers()
+	if err != nil {
+		return nil, err
+	}
+
+	if options.WithTags {
+		resources.Tags, err = client.getAllELBTags()
 		if err != nil {
-			slog.Error(fmt.Sprintf("getting all load balancers failed: %s", err.Error()))
-			return elbInfo.Info, &elbInfo.FilterMetrics
+			return nil, err
 		}
-		if allELBs == nil {
-			return elbInfo.Info, &elbInfo.FilterMetrics
+	}
+
+	for _, elb := range *allELBs {
+		resources.Info[elb.ID] = []string{elb.Name, elb.Provider, elb.VipAddress}
+		if options.Filters == nil {
+			continue
 		}
-		configMap := config.GetMetricFilters("SYS.ELB")
-		for _, elb := range *allELBs {
-			resourceInfos[elb.ID] = []string{elb.Name, elb.Provider, elb.VipAddress}
-			if configMap == nil {
-				continue
-			}
-			if metricNames, ok := configMap["lbaas_instance_id"]; ok {
-				filterMetrics = append(filterMetrics, buildSingleDimensionMetrics(metricNames, "SYS.ELB", "lbaas_instance_id", elb.ID)...)
-			}
-			if metricNames, ok := configMap["lbaas_instance_id,lbaas_listener_id"]; ok {
-				filterMetrics = append(filterMetrics, c.buildELBListenerMetrics(metricNames, &elb)...)
-			}
-			if metricNames, ok := configMap["lbaas_instance_id,lbaas_pool_id"]; ok {
-				filterMetrics = append(filterMetrics, c.buildELBPoolMetrics(metricNames, &elb)...)
-			}
+		if metricNames, ok := options.Filters["lbaas_instance_id"]; ok {
+			resources.FilterMetrics = append(resources.FilterMetrics, buildSingleDimensionMetrics(metricNames, "SYS.ELB", "lbaas_instance_id", elb.ID)...)
 		}
-
-		allListeners, err := c.Client.getAllListeners()
-		if err != nil {
-			slog.Error(fmt.Sprintf("getting all listeners failed: %s", err.Error()))
+		if metricNames, ok := options.Filters["lbaas_instance_id,lbaas_listener_id"]; ok {
+			resources.FilterMetrics = append(resources.FilterMetrics, buildELBListenerMetrics(metricNames, &elb)...)
 		}
-		if allListeners != nil {
-			for _, listener := range *allListeners {
-				resourceInfos[listener.ID] = []string{listener.Name, fmt.Sprintf("%d", listener.ProtocolPort)}
-			}
+		if metricNames, ok := options.Filters["lbaas_instance_id,lbaas_pool_id"]; ok {
+			resources.FilterMetrics = append(resources.FilterMetrics, buildELBPoolMetrics(metricNames, &elb)...)
 		}
+	}
 
-		elbInfo.Info = resourceInfos
-		elbInfo.FilterMetrics = filterMetrics
-		elbInfo.TTL = time.Now().Add(TTL).Unix()
+	allListeners, err := client.getAllListeners()
+	if err != nil {
+		slog.Error(fmt.Sprintf("getting all listeners failed: %s", err.Error()))
 	}
-	return elbInfo.Info, &elbInfo.FilterMetrics
+	if allListeners != nil {
+		for _, listener := range *allListeners {
+			resources.Info[listener.ID] = []string{listener.Name, fmt.Sprintf("%d", listener.ProtocolPort)}
+		}
+	}
+
+	return resources, nil
 }
 
-func (c *CloudEyeExporter) buildELBListenerMetrics(metricNames []string, elb *loadbalancers.LoadBalancer) []metrics.Metric {
+func buildELBListenerMetrics(metricNames []string, elb *loadbalancers.LoadBalancer) []metrics.Metric {
 	filterMetrics := make([]metrics.Metric, 0)
 	for listenerIndex := range elb.Listeners {
 		for index := range metricNames {
@@ -129,7 +114,7 @@ func (c *CloudEyeExporter) buildELBListenerMetrics(metricNames []string, elb *lo
 	return filterMetrics
 }
 
-func (c *CloudEyeExporter) buildELBPoolMetrics(metricNames []string, elb *loadbalancers.LoadBalancer) []metrics.Metric {
+func buildELBPoolMetrics(metricNames []string, elb *loadbalancers.LoadBalancer) []metrics.Metric {
 	filterMetrics := make([]metrics.Metric, 0)
 	for poolIndex := range elb.Pools {
 		for index := range metricNames {
@@ -152,310 +137,432 @@ func (c *CloudEyeExporter) buildELBPoolMetrics(metricNames []string, elb *loadba
 	return filterMetrics
 }
 
-func (c *CloudEyeExporter) getNATResourceInfo() (map[string][]string, *[]metrics.Metric) {
-	resourceInfos := make(map[string][]string)
-	filterMetrics := make([]metrics.Metric, 0)
-	natInfo.Lock()
-	defer natInfo.Unlock()
-	if natInfo.Info == nil || time.Now().Unix() > natInfo.TTL {
-		allnat, err := c.Client.getAllNatGateways()
-		if err != nil {
-			slog.Error(fmt.Sprintf("getting all NAT gateways failed: %s", err.Error()))
-			return natInfo.Info, &natInfo.FilterMetrics
-		}
-		if allnat == nil {
-			return natInfo.Info, &natInfo.FilterMetrics
-		}
-		configMap := config.GetMetricFilters("SYS.NAT")
-		for _, nat := range *allnat {
-			resourceInfos[nat.ID] = []string{nat.Name}
-			if configMap == nil {
-				continue
-			}
-			if metricNames, ok := configMap["nat_gateway_id"]; ok {
-				filterMetrics = append(filterMetrics, buildSingleDimensionMetrics(metricNames, "SYS.NAT", "nat_gateway_id", nat.ID)...)
-			}
-		}
+type natProvider struct{}
+
+func (p *natProvider) Namespace() string {
+	return "SYS.NAT"
+}
+
+func (p *natProvider) ServiceClient(client *OpenTelekomCloudClient) (*golangsdk.ServiceClient, error) {
+	return client.GetNATClient()
+}
 
-		natInfo.Info = resourceInfos
-		natInfo.FilterMetrics = filterMetrics
-		natInfo.TTL = time.Now().Add(TTL).Unix()
+func (p *natProvider) ExtensionLabels() map[string][]string {
+	return map[string][]string{
+		"sys_nat": {"name"},
 	}
-	return natInfo.Info, &natInfo.FilterMetrics
 }
 
-func (c *CloudEyeExporter) getRDSResourceInfo() (map[string][]string, *[]metrics.Metric) {
-	resourceInfos := make(map[string][]string)
-	filterMetrics := make([]metrics.Metric, 0)
-	rdsInfo.Lock()
-	defer rdsInfo.Unlock()
-	if rdsInfo.Info == nil || time.Now().Unix() > rdsInfo.TTL {
-		allrds, err := c.Client.getAllRDSs()
-		if err != nil {
-			slog.Error(fmt.Sprintf("getting all RDS instances failed: %s", err.Error()))
-			return rdsInfo.Info, &rdsInfo.FilterMetrics
-		}
-		if allrds == nil {
-			return rdsInfo.Info, &rdsInfo.FilterMetrics
+func (p *natProvider) Resources(client *OpenTelekomCloudClient, options ResourceOptions) (*Resources, error) {
+	resources := newResources()
+	allnat, err := client.getAllNatGateways()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, nat := range *allnat {
+		resources.Info[nat.ID] = []string{nat.Name}
+		if options.Filters == nil {
+			continue
 		}
-		configMap := config.GetMetricFilters("SYS.RDS")
-		for _, rds := range allrds.Instances {
-			resourceInfos[rds.Id] = []string{rds.Name}
-			for _, node := range rds.Nodes {
-				resourceInfos[node.Id] = []string{fmt.Sprintf("%d", rds.Port), node.Name, node.Role}
-			}
-			if configMap == nil {
-				continue
-			}
-			var dimName string
-			switch rds.DataStore.Type {
-			case "MySQL":
-				dimName = "rds_cluster_id"
-			case "PostgreSQL":
-				dimName = "postgresql_cluster_id"
-			case "SQLServer":
-				dimName = "rds_cluster_sqlserver_id"
-			}
-			if metricNames, ok := configMap[dimName]; ok {
-				filterMetrics = append(filterMetrics, buildSingleDimensionMetrics(metricNames, "SYS.RDS", dimName, rds.Id)...)
-			}
+		if metricNames, ok := options.Filters["nat_gateway_id"]; ok {
+			resources.FilterMetrics = append(resources.FilterMetrics, buildSingleDimensionMetrics(metricNames, "SYS.NAT", "nat_gateway_id", nat.ID)...)
 		}
+	}
+
+	return resources, nil
+}
+
+type rdsProvider struct{}
+
+func (p *rdsProvider) Namespace() string {
+	return "SYS.RDS"
+}
+
+func (p *rdsProvider) ServiceClient(client *OpenTelekomCloudClient) (*golangsdk.ServiceClient, error) {
+	return client.GetRDSClient()
+}
 
-		rdsInfo.Info = resourceInfos
-		rdsInfo.FilterMetrics = filterMetrics
-		rdsInfo.TTL = time.Now().Add(TTL).Unix()
+func (p *rdsProvider) ExtensionLabels() map[string][]string {
+	return map[string][]string{
+		"sys_rds":          {"name"},
+		"sys_rds_instance": {"port", "name", "role"},
 	}
-	return rdsInfo.Info, &rdsInfo.FilterMetrics
 }
 
-func (c *CloudEyeExporter) getDMSResourceInfo() (map[string][]string, *[]metrics.Metric) {
-	resourceInfos := map[string][]string{}
-	dmsInfo.Lock()
-	defer dmsInfo.Unlock()
-	if dmsInfo.Info == nil || time.Now().Unix() > dmsInfo.TTL {
-		allDmsInstance, err := c.Client.getAllDMSs()
-		if err != nil {
-			slog.Error(fmt.Sprintf("getting all DMS instances failed: %s", err.Error()))
-			return dmsInfo.Info, &dmsInfo.FilterMetrics
+func (p *rdsProvider) Tagged() bool {
+	return true
+}
+
+func (p *rdsProvider) Resources(client *OpenTelekomCloudClient, options ResourceOptions) (*Resources, error) {
+	resources := newResources()
+	allrds, err := client.getAllRDSs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rds := range allrds.Instances {
+		resources.Info[rds.Id] = []string{rds.Name}
+		resources.Tags[rds.Id] = make(map[string]string)
+		for _, tag := range rds.Tags {
+			resources.Tags[rds.Id][tag.Key] = tag.Value
 		}
-		if allDmsInstance == nil {
-			return dmsInfo.Info, &dmsInfo.FilterMetrics
+		for _, node := range rds.Nodes {
+			resources.Info[node.Id] = []string{fmt.Sprintf("%d", rds.Port), node.Name, node.Role}
 		}
-
-		for _, dms := range allDmsInstance.Instances {
-			resourceInfos[dms.InstanceID] = []string{dms.Name, dms.EngineVersion, dms.ResourceSpecCode, dms.ConnectAddress,
-				fmt.Sprintf("%d", dms.Port)}
+		if options.Filters == nil {
+			continue
 		}
-
-		allQueues, err := c.Client.getAllDMSQueues()
-		if err != nil {
-			slog.Error(fmt.Sprintf("getting all DMS queues failed: %s", err.Error()))
+		var dimName string
+		switch rds.DataStore.Type {
+		case "MySQL":
+			dimName = "rds_cluster_id"
+		case "PostgreSQL":
+			dimName = "postgresql_cluster_id"
+		case "SQLServer":
+			dimName = "rds_cluster_sqlserver_id"
 		}
-		if allQueues != nil {
-			for _, queue := range *allQueues {
-				resourceInfos[queue.ID] = []string{queue.Name}
-			}
+		if metricNames, ok := options.Filters[dimName]; ok {
+			resources.FilterMetrics = append(resources.FilterMetrics, buildSingleDimensionMetrics(metricNames, "SYS.RDS", dimName, rds.Id)...)
 		}
+	}
 
-		dmsInfo.Info = resourceInfos
-		dmsInfo.TTL = time.Now().Add(TTL).Unix()
+	return resources, nil
+}
+
+type dmsProvider struct{}
+
+func (p *dmsProvider) Namespace() string {
+	return "SYS.DMS"
+}
+
+func (p *dmsProvider) ServiceClient(client *OpenTelekomCloudClient) (*golangsdk.ServiceClient, error) {
+	return client.GetDMSClient()
+}
+
+func (p *dmsProvider) ExtensionLabels() map[string][]string {
+	return map[string][]string{
+		"sys_dms":                 {"name"},
+		"sys_dms_instance":        {"name", "engine_version", "resource_spec_code", "connect_address", "port"},
+		"sys_dms_instance_broker": {"name", "engine_version", "resource_spec_code", "connect_address", "port"},
+		"sys_dms_instance_topics": {"name", "engine_version", "resource_spec_code", "connect_address", "port"},
 	}
-	return dmsInfo.Info, &dmsInfo.FilterMetrics
 }
 
-func (c *CloudEyeExporter) getDCSResourceInfo() (map[string][]string, *[]metrics.Metric) {
-	resourceInfos := make(map[string][]string)
-	filterMetrics := make([]metrics.Metric, 0)
-	dcsInfo.Lock()
-	defer dcsInfo.Unlock()
-	if dcsInfo.Info == nil || time.Now().Unix() > dcsInfo.TTL {
-		allDcs, err := c.Client.getAllDCSs()
-		if err != nil {
-			slog.Error(fmt.Sprintf("getting all DCS failed: %s", err.Error()))
-			return dcsInfo.Info, &dcsInfo.FilterMetrics
-		}
-		if allDcs == nil {
-			return dcsInfo.Info, &dcsInfo.FilterMetrics
-		}
-		configMap := config.GetMetricFilters("SYS.DCS")
-		for _, dcs := range allDcs.Instances {
-			resourceInfos[dcs.InstanceID] = []string{dcs.IP, fmt.Sprintf("%d", dcs.Port), dcs.Name, dcs.Engine}
-			if configMap == nil {
-				continue
-			}
-			var dimName string
-			switch dcs.Engine {
-			case "Redis":
-				dimName = "dcs_instance_id"
-			case "Memcached":
-				dimName = "dcs_memcached_instance_id"
+func (p *dmsProvider) Resources(client *OpenTelekomCloudClient, options ResourceOptions) (*Resources, error) {
+	resources := newResources()
+	allDmsInstance, err := client.getAllDMSs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dms := range allDmsInstance.Instances {
+		resources.Info[dms.InstanceID] = []string{dms.Name, dms.EngineVersion, dms.ResourceSpecCode, dms.ConnectAddress,
+			fmt.Sprintf("%d", dms.Port)}
+		if options.Filters == nil {
+			continue
+		}
+		switch dms.Engine {
+		case "kafka":
+			kafkaMetrics, err := buildKafkaMetrics(client, options.Filters, dms.InstanceID)
+			if err != nil {
+				return nil, err
 			}
-			if metricNames, ok := configMap[dimName]; ok {
-				filterMetrics = append(filterMetrics, buildSingleDimensionMetrics(metricNames, "SYS.DCS", dimName, dcs.InstanceID)...)
+			resources.FilterMetrics = append(resources.FilterMetrics, kafkaMetrics...)
+		case "rabbitmq":
+			if metricNames, ok := options.Filters["rabbitmq_instance_id"]; ok {
+				resources.FilterMetrics = append(resources.FilterMetrics, buildSingleDimensionMetrics(metricNames, "SYS.DMS", "rabbitmq_instance_id", dms.InstanceID)...)
 			}
 		}
+	}
 
-		dcsInfo.Info = resourceInfos
-		dcsInfo.FilterMetrics = filterMetrics
-		dcsInfo.TTL = time.Now().Add(TTL).Unix()
+	allQueues, err := client.getAllDMSQueues()
+	if err != nil {
+		slog.Error(fmt.Sprintf("getting all DMS queues failed: %s", err.Error()))
+	}
+	if allQueues != nil {
+		for _, queue := range *allQueues {
+			resources.Info[queue.ID] = []string{queue.Name}
+		}
 	}
-	return dcsInfo.Info, &dcsInfo.FilterMetrics
+
+	return resources, nil
 }
 
-func (c *CloudEyeExporter) getVPCResourceInfo() (map[string][]string, *[]metrics.Metric) {
-	resourceInfos := map[string][]string{}
-	vpcInfo.Lock()
-	defer vpcInfo.Unlock()
-	if vpcInfo.Info == nil || time.Now().Unix() > vpcInfo.TTL {
-		allPublicIps, err := c.Client.getAllPublicIPs()
+// buildKafkaMetrics builds the metrics of a Kafka instance, of its brokers and
+// of its topics, failing if the brokers or the topics cannot be listed.
+func buildKafkaMetrics(client *OpenTelekomCloudClient, filters map[string][]string, instanceID string) ([]metrics.Metric, error) {
+	filterMetrics := make([]metrics.Metric, 0)
+	if metricNames, ok := filters["kafka_instance_id"]; ok {
+		filterMetrics = append(filterMetrics, buildSingleDimensionMetrics(metricNames, "SYS.DMS", "kafka_instance_id", instanceID)...)
+	}
+
+	if metricNames, ok := filters["kafka_instance_id,kafka_broker"]; ok && len(metricNames) > 0 {
+		brokers, err := client.getKafkaBrokers(instanceID, metricNames[0])
 		if err != nil {
-			slog.Error(fmt.Sprintf("getting all public ips failed: %s", err.Error()))
+			return nil, err
 		}
-		if allPublicIps != nil {
-			for _, publicIp := range *allPublicIps {
-				resourceInfos[publicIp.ID] = []string{publicIp.BandwidthName, publicIp.PublicIpAddress, publicIp.Type}
-			}
+		for _, broker := range brokers {
+			filterMetrics = append(filterMetrics, buildDoubleDimensionMetrics(metricNames, "SYS.DMS", "kafka_instance_id", instanceID, "kafka_broker", broker)...)
 		}
+	}
 
-		allBandwidth, err := c.Client.getAllBandwidth()
+	if metricNames, ok := filters["kafka_instance_id,kafka_topics"]; ok {
+		allTopics, err := client.getAllKafkaTopics(instanceID)
 		if err != nil {
-			slog.Error(fmt.Sprintf("getting all bandwidth failed: %s", err.Error()))
-			return resourceInfos, &vpcInfo.FilterMetrics
+			return nil, err
 		}
-		if allBandwidth != nil {
-			for _, bandwidth := range *allBandwidth {
-				resourceInfos[bandwidth.ID] = []string{bandwidth.Name, fmt.Sprintf("%d", bandwidth.Size), bandwidth.ShareType, bandwidth.BandwidthType, bandwidth.ChargeMode}
-			}
+		for _, topic := range allTopics {
+			filterMetrics = append(filterMetrics, buildDoubleDimensionMetrics(metricNames, "SYS.DMS", "kafka_instance_id", instanceID, "kafka_topics", topic.Name)...)
 		}
+	}
+
+	return filterMetrics, nil
+}
+
+type dcsProvider struct{}
 
-		vpcInfo.Info = resourceInfos
-		vpcInfo.TTL = time.Now().Add(TTL).Unix()
+func (p *dcsProvider) Namespace() string {
+	return "SYS.DCS"
+}
+
+func (p *dcsProvider) ServiceClient(client *OpenTelekomCloudClient) (*golangsdk.ServiceClient, error) {
+	return client.GetDCSClient()
+}
+
+func (p *dcsProvider) ExtensionLabels() map[string][]string {
+	return map[string][]string{
+		"sys_dcs": {"ip", "port", "name", "engine"},
 	}
-	return vpcInfo.Info, &vpcInfo.FilterMetrics
 }
 
-func (c *CloudEyeExporter) getEVSResourceInfo() (map[string][]string, *[]metrics.Metric) {
-	resourceInfos := map[string][]string{}
-	evsInfo.Lock()
-	defer evsInfo.Unlock()
-	if evsInfo.Info == nil || time.Now().Unix() > evsInfo.TTL {
-		allVolumes, err := c.Client.getAllVolumes()
-		if err != nil {
-			slog.Error(fmt.Sprintf("getting all volumes failed: %s", err.Error()))
-			return evsInfo.Info, &evsInfo.FilterMetrics
-		}
-		if allVolumes == nil {
-			return evsInfo.Info, &evsInfo.FilterMetrics
-		}
+func (p *dcsProvider) Tagged() bool {
+	return true
+}
 
-		for _, volume := range *allVolumes {
-			if len(volume.Attachments) > 0 {
-				device := strings.Split(volume.Attachments[0].Device, "/")
-				resourceInfos[fmt.Sprintf("%s-%s", volume.Attachments[0].ServerID, device[len(device)-1])] = []string{volume.Name, volume.Attachments[0].ServerID, volume.Attachments[0].Device}
+func (p *dcsProvider) Resources(client *OpenTelekomCloudClient, options ResourceOptions) (*Resources, error) {
+	resources := newResources()
+	allDcs, err := client.getAllDCSs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dcs := range allDcs.Instances {
+		resources.Info[dcs.InstanceID] = []string{dcs.IP, fmt.Sprintf("%d", dcs.Port), dcs.Name, dcs.Engine}
+		if options.WithTags {
+			resources.Tags[dcs.InstanceID], err = client.getDCSTags(dcs.InstanceID)
+			if err != nil {
+				return nil, err
 			}
 		}
+		if options.Filters == nil {
+			continue
+		}
+		var dimName string
+		switch dcs.Engine {
+		case "Redis":
+			dimName = "dcs_instance_id"
+		case "Memcached":
+			dimName = "dcs_memcached_instance_id"
+		}
+		if metricNames, ok := options.Filters[dimName]; ok {
+			resources.FilterMetrics = append(resources.FilterMetrics, buildSingleDimensionMetrics(metricNames, "SYS.DCS", dimName, dcs.InstanceID)...)
+		}
+	}
+
+	return resources, nil
+}
 
-		evsInfo.Info = resourceInfos
-		evsInfo.TTL = time.Now().Add(TTL).Unix()
+type vpcProvider struct{}
+
+func (p *vpcProvider) Namespace() string {
+	return "SYS.VPC"
+}
+
+func (p *vpcProvider) ServiceClient(client *OpenTelekomCloudClient) (*golangsdk.ServiceClient, error) {
+	return client.GetVPCClient()
+}
+
+func (p *vpcProvider) ExtensionLabels() map[string][]string {
+	return map[string][]string{
+		"sys_vpc_bandwidth": {"name", "size", "share_type", "bandwidth_type", "charge_mode"},
+		"sys_vpc_eip":       {"name", "public_ip_address", "type"},
 	}
-	return evsInfo.Info, &evsInfo.FilterMetrics
 }
 
-func (c *CloudEyeExporter) getECSResourceInfo() (map[string][]string, *[]metrics.Metric) {
-	resourceInfos := map[string][]string{}
-	ecsInfo.Lock()
-	defer ecsInfo.Unlock()
-	if ecsInfo.Info == nil || time.Now().Unix() > ecsInfo.TTL {
-		allServers, err := c.Client.getAllServers()
-		if err != nil {
-			slog.Error(fmt.Sprintf("getting all servers failed: %s", err.Error()))
-			return ecsInfo.Info, &ecsInfo.FilterMetrics
+func (p *vpcProvider) Resources(client *OpenTelekomCloudClient, options ResourceOptions) (*Resources, error) {
+	resources := newResources()
+	allPublicIps, err := client.getAllPublicIPs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, publicIp := range *allPublicIps {
+		resources.Info[publicIp.ID] = []string{publicIp.BandwidthName, publicIp.PublicIpAddress, publicIp.Type}
+		if metricNames, ok := options.Filters["publicip_id"]; ok {
+			resources.FilterMetrics = append(resources.FilterMetrics, buildSingleDimensionMetrics(metricNames, "SYS.VPC", "publicip_id", publicIp.ID)...)
 		}
-		if allServers == nil {
-			return ecsInfo.Info, &ecsInfo.FilterMetrics
+	}
+
+	allBandwidth, err := client.getAllBandwidth()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, bandwidth := range *allBandwidth {
+		resources.Info[bandwidth.ID] = []string{bandwidth.Name, fmt.Sprintf("%d", bandwidth.Size), bandwidth.ShareType, bandwidth.BandwidthType, bandwidth.ChargeMode}
+		if metricNames, ok := options.Filters["bandwidth_id"]; ok {
+			resources.FilterMetrics = append(resources.FilterMetrics, buildSingleDimensionMetrics(metricNames, "SYS.VPC", "bandwidth_id", bandwidth.ID)...)
 		}
+	}
+
+	return resources, nil
+}
+
+type evsProvider struct{}
+
+func (p *evsProvider) Namespace() string {
+	return "SYS.EVS"
+}
+
+func (p *evsProvider) ServiceClient(client *OpenTelekomCloudClient) (*golangsdk.ServiceClient, error) {
+	return client.GetEVSClient()
+}
+
+func (p *evsProvider) ExtensionLabels() map[string][]string {
+	return map[string][]string{
+		"sys_evs": {"name", "server_id", "device"},
+	}
+}
+
+func (p *evsProvider) Resources(client *OpenTelekomCloudClient, options ResourceOptions) (*Resources, error) {
+	resources := newResources()
+	allVolumes, err := client.getAllVolumes()
+	if err != nil {
+		return nil, err
+	}
 
-		for _, server := range *allServers {
-			resourceInfos[server.ID] = []string{server.Name}
+	for _, volume := range *allVolumes {
+		if len(volume.Attachments) > 0 {
+			device := strings.Split(volume.Attachments[0].Device, "/")
+			diskName := fmt.Sprintf("%s-%s", volume.Attachments[0].ServerID, device[len(device)-1])
+			resources.Info[diskName] = []string{volume.Name, volume.Attachments[0].ServerID, volume.Attachments[0].Device}
+			if metricNames, ok := options.Filters["disk_name"]; ok {
+				resources.FilterMetrics = append(resources.FilterMetrics, buildSingleDimensionMetrics(metricNames, "SYS.EVS", "disk_name", diskName)...)
+			}
 		}
+	}
+
+	return resources, nil
+}
+
+type ecsProvider struct{}
+
+func (p *ecsProvider) Namespace() string {
+	return "SYS.ECS"
+}
+
+func (p *ecsProvider) ServiceClient(client *OpenTelekomCloudClient) (*golangsdk.ServiceClient, error) {
+	return client.GetECSClient()
+}
 
-		ecsInfo.Info = resourceInfos
-		ecsInfo.TTL = time.Now().Add(TTL).Unix()
+func (p *ecsProvider) ExtensionLabels() map[string][]string {
+	return map[string][]string{
+		"sys_ecs": {"hostname"},
 	}
-	return ecsInfo.Info, &ecsInfo.FilterMetrics
 }
 
-func (c *CloudEyeExporter) getASResourceInfo() (map[string][]string, *[]metrics.Metric) {
-	resourceInfos := map[string][]string{}
-	asInfo.Lock()
-	defer asInfo.Unlock()
-	if asInfo.Info == nil || time.Now().Unix() > asInfo.TTL {
-		allGroups, err := c.Client.getAllAutoscalingGroups()
+func (p *ecsProvider) Tagged() bool {
+	return true
+}
+
+func (p *ecsProvider) Resources(client *OpenTelekomCloudClient, options ResourceOptions) (*Resources, error) {
+	resources := newResources()
+	allServers, err := client.getAllServers()
+	if err != nil {
+		return nil, err
+	}
+
+	if options.WithTags {
+		resources.Tags, err = client.getAllECSTags()
 		if err != nil {
-			slog.Error(fmt.Sprintf("getting all autoscaling groups failed: %s", err.Error()))
-			return asInfo.Info, &asInfo.FilterMetrics
+			return nil, err
 		}
-		if allGroups == nil {
-			return asInfo.Info, &asInfo.FilterMetrics
+	}
+
+	for _, server := range *allServers {
+		resources.Info[server.ID] = []string{server.Name}
+		if metricNames, ok := options.Filters["instance_id"]; ok {
+			resources.FilterMetrics = append(resources.FilterMetrics, buildSingleDimensionMetrics(metricNames, "SYS.ECS", "instance_id", server.ID)...)
 		}
+	}
+
+	return resources, nil
+}
+
+type asProvider struct{}
 
-		for _, group := range *allGroups {
-			resourceInfos[group.ID] = []string{group.Name, group.Status}
+func (p *asProvider) Namespace() string {
+	return "SYS.AS"
+}
+
+func (p *asProvider) ServiceClient(client *OpenTelekomCloudClient) (*golangsdk.ServiceClient, error) {
+	return client.GetASClient()
+}
+
+func (p *asProvider) ExtensionLabels() map[string][]string {
+	return map[string][]string{
+		"sys_as": {"name", "status"},
+	}
+}
+
+func (p *asProvider) Resources(client *OpenTelekomCloudClient, options ResourceOptions) (*Resources, error) {
+	resources := newResources()
+	allGroups, err := client.getAllAutoscalingGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, group := range *allGroups {
+		resources.Info[group.ID] = []string{group.Name, group.Status}
+		if metricNames, ok := options.Filters["AutoScalingGroup"]; ok {
+			resources.FilterMetrics = append(resources.FilterMetrics, buildSingleDimensionMetrics(metricNames, "SYS.AS", "AutoScalingGroup", group.ID)...)
 		}
+	}
+
+	return resources, nil
+}
+
+type fgsProvider struct{}
+
+func (p *fgsProvider) Namespace() string {
+	return "SYS.FunctionGraph"
+}
+
+func (p *fgsProvider) ServiceClient(client *OpenTelekomCloudClient) (*golangsdk.ServiceClient, error) {
+	return client.GetFGSClient()
+}
 
-		asInfo.Info = resourceInfos
-		asInfo.TTL = time.Now().Add(TTL).Unix()
+func (p *fgsProvider) ExtensionLabels() map[string][]string {
+	return map[string][]string{
+		"sys_functiongraph": {"func_urn"},
 	}
-	return asInfo.Info, &asInfo.FilterMetrics
 }
 
-func (c *CloudEyeExporter) getFGSResourceInfo() (map[string][]string, *[]metrics.Metric) {
-	resourceInfos := map[string][]string{}
-	fgsInfo.Lock()
-	defer fgsInfo.Unlock()
-	if fgsInfo.Info == nil || time.Now().Unix() > fgsInfo.TTL {
-		functionList, err := c.Client.getAllFunctions()
-		if err != nil {
-			slog.Error(fmt.Sprintf("getting all functions failed: %s", err.Error()))
-			return fgsInfo.Info, &fgsInfo.FilterMetrics
-		}
-		if functionList == nil {
-			return fgsInfo.Info, &fgsInfo.FilterMetrics
-		}
-
-		for _, function := range functionList.Functions {
-			resourceInfos[fmt.Sprintf("%s-%s", function.Package, function.FuncName)] = []string{function.FuncUrn}
-		}
-
-		fgsInfo.Info = resourceInfos
-		fgsInfo.TTL = time.Now().Add(TTL).Unix()
-	}
-	return fgsInfo.Info, &fgsInfo.FilterMetrics
-}
-
-func (c *CloudEyeExporter) getAllResources(namespace string) (map[string][]string, *[]metrics.Metric) {
-	switch namespace {
-	case "SYS.ELB":
-		return c.getELBResourceInfo()
-	case "SYS.NAT":
-		return c.getNATResourceInfo()
-	case "SYS.RDS":
-		return c.getRDSResourceInfo()
-	case "SYS.DMS":
-		return c.getDMSResourceInfo()
-	case "SYS.DCS":
-		return c.getDCSResourceInfo()
-	case "SYS.VPC":
-		return c.getVPCResourceInfo()
-	case "SYS.EVS":
-		return c.getEVSResourceInfo()
-	case "SYS.ECS":
-		return c.getECSResourceInfo()
-	case "SYS.AS":
-		return c.getASResourceInfo()
-	case "SYS.FunctionGraph":
-		return c.getFGSResourceInfo()
-	default:
-		return map[string][]string{}, &[]metrics.Metric{}
+func (p *fgsProvider) Resources(client *OpenTelekomCloudClient, options ResourceOptions) (*Resources, error) {
+	resources := newResources()
+	functionList, err := client.getAllFunctions()
+	if err != nil {
+		return nil, err
 	}
+
+	for _, function := range functionList.Functions {
+		functionName := fmt.Sprintf("%s-%s", function.Package, function.FuncName)
+		resources.Info[functionName] = []string{function.FuncUrn}
+		if metricNames, ok := options.Filters["package-functionname"]; ok {
+			resources.FilterMetrics = append(resources.FilterMetrics, buildSingleDimensionMetrics(metricNames, "SYS.FunctionGraph", "package-functionname", functionName)...)
+		}
+	}
+
+	return resources, nil
 }
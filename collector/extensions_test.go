@@ -0,0 +1,35 @@
+package collector
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestResourcesListingFailures(t *testing.T) {
+	iam := &fakeIAM{
+		lifetime: 24 * time.Hour,
+		services: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}),
+	}
+	client, _ := newTestClient(t, iam)
+
+	t.Run("public ips", func(t *testing.T) {
+		resources, err := (&vpcProvider{}).Resources(client, ResourceOptions{})
+		if err == nil {
+			t.Errorf("Resources() = %v, want the error listing the public ips", resources)
+		}
+	})
+
+	t.Run("kafka brokers", func(t *testing.T) {
+		filters := map[string][]string{
+			"kafka_instance_id":              {"current_partitions"},
+			"kafka_instance_id,kafka_broker": {"broker_data_size"},
+		}
+		filterMetrics, err := buildKafkaMetrics(client, filters, "kafka-1")
+		if err == nil {
+			t.Errorf("buildKafkaMetrics() = %v, want the error listing the brokers", filterMetrics)
+		}
+	})
+}
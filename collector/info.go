@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"strings"
+	"sync"
+)
+
+// resourceInfoSet keeps track of the resources an info metric was already
+// pushed for during a collection, so that every resource gets a single one.
+type resourceInfoSet struct {
+	seen map[string]struct{}
+	sync.Mutex
+}
+
+func newResourceInfoSet() *resourceInfoSet {
+	return &resourceInfoSet{
+		seen: make(map[string]struct{}),
+	}
+}
+
+// add reports whether the resource was not seen before.
+func (s *resourceInfoSet) add(key string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.seen[key]; ok {
+		return false
+	}
+
+	s.seen[key] = struct{}{}
+	return true
+}
+
+// getResourceInfoMetric returns the info metric of the resource a metric
+// originates from, named after the namespace and the dimensions of the metric,
+// e.g. <prefix>_sys_elb_lbaas_instance_id_info, as namespaces with several
+// dimension sets have differently labelled info metrics. It carries the
+// dimensions of the metric, to be joined on, and the extension labels of the
+// resource. It returns nil if the resource is unknown or its info metric was
+// already pushed.
+func (c *CloudEyeExporter) getResourceInfoMetric(allResourcesInfo map[string][]string, metric metricData, infos *resourceInfoSet) (prometheus.Metric, error) {
+	extensionValues, ok := allResourcesInfo[getOriginalID(&metric.Dimensions)]
+	if !ok {
+		return nil, nil
+	}
+
+	labels, values, preResourceName, privateFlag := getOriginalLabelInfo(&metric.Dimensions)
+	labels = append(labels, getExtensionLabelNames(getExtensionKey(metric.Namespace, preResourceName, privateFlag))...)
+	labels = append(labels, c.tagLabelNames(metric.Namespace)...)
+	values = append(values, extensionValues...)
+	if len(labels) != len(values) {
+		return nil, fmt.Errorf("inconsistent info label and value: expected %d label %#v, but values got %d in %#v", len(labels), labels, len(values), values)
+	}
+
+	dimensionNames := make([]string, 0, len(metric.Dimensions))
+	for _, dimension := range metric.Dimensions {
+		dimensionNames = append(dimensionNames, strings.ReplaceAll(dimension.Name, "-", "_"))
+	}
+	fqName := prometheus.BuildFQName(getMetricPrefixName(c.Prefix, metric.Namespace), strings.Join(dimensionNames, "_"), "info")
+	if !infos.add(fmt.Sprintf("%s%v", fqName, values)) {
+		return nil, nil
+	}
+
+	desc := prometheus.NewDesc(fqName, fmt.Sprintf("Information about a resource of %s.", metric.Namespace), labels, c.constLabels())
+	return prometheus.NewConstMetric(desc, prometheus.GaugeValue, 1, values...)
+}
@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"github.com/akyriako/cloudeye-exporter/config"
+	"github.com/huaweicloud/golangsdk/openstack/ces/v1/metricdata"
+	"strings"
+	"testing"
+)
+
+func TestGetResourceInfoMetric(t *testing.T) {
+	exporter := &CloudEyeExporter{CloudConfig: &config.CloudConfig{}, Prefix: "opentelekomcloud", Account: "a"}
+	resourcesInfo := map[string][]string{
+		"mysql-1":    {"mysql"},
+		"postgres-1": {"postgres"},
+	}
+	infos := newResourceInfoSet()
+
+	tests := []struct {
+		name       string
+		dimension  metricdata.Dimension
+		wantFQName string
+		wantLabels string
+	}{
+		{
+			name:       "mysql",
+			dimension:  metricdata.Dimension{Name: "rds_cluster_id", Value: "mysql-1"},
+			wantFQName: "opentelekomcloud_sys_rds_rds_cluster_id_info",
+			wantLabels: "{rds_cluster_id,name}",
+		},
+		{
+			name:       "postgresql",
+			dimension:  metricdata.Dimension{Name: "postgresql_cluster_id", Value: "postgres-1"},
+			wantFQName: "opentelekomcloud_sys_rds_postgresql_cluster_id_info",
+			wantLabels: "{postgresql_cluster_id,name}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metric := metricData{Namespace: "SYS.RDS", Dimensions: []metricdata.Dimension{tt.dimension}}
+
+			info, err := exporter.getResourceInfoMetric(resourcesInfo, metric, infos)
+			if err != nil || info == nil {
+				t.Fatalf("getResourceInfoMetric() = %v, %v, want an info metric", info, err)
+			}
+			desc := info.Desc().String()
+			if !strings.Contains(desc, `fqName: "`+tt.wantFQName+`"`) || !strings.Contains(desc, "variableLabels: "+tt.wantLabels) {
+				t.Errorf("desc = %s, want %s with labels %s", desc, tt.wantFQName, tt.wantLabels)
+			}
+
+			again, err := exporter.getResourceInfoMetric(resourcesInfo, metric, infos)
+			if err != nil || again != nil {
+				t.Errorf("getResourceInfoMetric() = %v, %v, want nil for a resource already seen", again, err)
+			}
+		})
+	}
+}
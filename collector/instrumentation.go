@@ -0,0 +1,168 @@
+package collector
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+const internalNamespace = "cloudeye_exporter"
+
+// InternalRegistry holds the metrics the exporter exposes about itself, it is
+// served apart from the CES metrics.
+var InternalRegistry = prometheus.NewRegistry()
+
+var (
+	buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: internalNamespace,
+		Name:      "build_info",
+		Help:      "A metric with a constant '1' value labeled by version, revision and goversion of the exporter.",
+	}, []string{"version", "revision", "goversion"})
+
+	namespaceScrapeDuration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: internalNamespace,
+		Name:      "namespace_scrape_duration_seconds",
+		Help:      "Duration of the last collection of a namespace.",
+	}, []string{"account", "namespace"})
+
+	namespaceScrapeSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: internalNamespace,
+		Name:      "namespace_scrape_success",
+		Help:      "Whether the last collection of a namespace succeeded.",
+	}, []string{"account", "namespace"})
+
+	namespaceSeries = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: internalNamespace,
+		Name:      "namespace_series",
+		Help:      "Number of series emitted by the last collection of a namespace.",
+	}, []string{"account", "namespace"})
+
+	apiRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: internalNamespace,
+		Name:      "api_requests_total",
+		Help:      "Number of requests sent to the Open Telekom Cloud APIs, by service and status code.",
+	}, []string{"service", "code"})
+
+	apiRequestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: internalNamespace,
+		Name:      "api_request_errors_total",
+		Help:      "Number of requests to the Open Telekom Cloud APIs that failed or got an error status code.",
+	}, []string{"service"})
+
+	apiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: internalNamespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "Latency of the requests sent to the Open Telekom Cloud APIs.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"service"})
+
+	rateLimiterWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: internalNamespace,
+		Name:      "rate_limiter_wait_seconds",
+		Help:      "Time requests to the Open Telekom Cloud APIs were held back by the rate limiter of their service.",
+		Buckets:   []float64{0, .01, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"service"})
+
+	resourceCacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: internalNamespace,
+		Name:      "resource_cache_requests_total",
+		Help:      "Number of lookups of the resource cache of a namespace, by result (hit, stale or miss).",
+	}, []string{"namespace", "result"})
+
+	configLastReloadSuccessful = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: internalNamespace,
+		Name:      "config_last_reload_successful",
+		Help:      "Whether the last reload of the configuration succeeded.",
+	})
+
+	configLastReloadSuccessTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: internalNamespace,
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "Timestamp of the last successful reload of the configuration.",
+	})
+
+	resourceCacheRefreshFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: internalNamespace,
+		Name:      "resource_cache_refresh_failures_total",
+		Help:      "Number of failed listings of the resources of a namespace of an account.",
+	}, []string{"account", "namespace"})
+)
+
+func init() {
+	InternalRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		buildInfo,
+		namespaceScrapeDuration,
+		namespaceScrapeSuccess,
+		namespaceSeries,
+		apiRequests,
+		apiRequestErrors,
+		apiRequestDuration,
+		rateLimiterWait,
+		resourceCacheRequests,
+		resourceCacheRefreshFailures,
+		configLastReloadSuccessful,
+		configLastReloadSuccessTimestamp,
+	)
+}
+
+func SetBuildInfo(version string, revision string) {
+	buildInfo.WithLabelValues(version, revision, runtime.Version()).Set(1)
+}
+
+func observeNamespaceScrape(account string, namespace string, duration time.Duration, series int, err error) {
+	success := 1.0
+	if err != nil {
+		success = 0
+	}
+
+	namespaceScrapeDuration.WithLabelValues(account, namespace).Set(duration.Seconds())
+	namespaceScrapeSuccess.WithLabelValues(account, namespace).Set(success)
+	namespaceSeries.WithLabelValues(account, namespace).Set(float64(series))
+}
+
+func ObserveConfigReload(err error) {
+	if err != nil {
+		configLastReloadSuccessful.Set(0)
+		return
+	}
+
+	configLastReloadSuccessful.Set(1)
+	configLastReloadSuccessTimestamp.SetToCurrentTime()
+}
+
+// instrumentedTransport records count, latency and errors of every request
+// sent to the Open Telekom Cloud APIs.
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	service := getService(req)
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	apiRequestDuration.WithLabelValues(service).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		apiRequests.WithLabelValues(service, "error").Inc()
+		apiRequestErrors.WithLabelValues(service).Inc()
+		return resp, err
+	}
+
+	apiRequests.WithLabelValues(service, fmt.Sprintf("%d", resp.StatusCode)).Inc()
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiRequestErrors.WithLabelValues(service).Inc()
+	}
+
+	return resp, err
+}
+
+var resourceCacheAgeDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(internalNamespace, "", "resource_cache_age_seconds"),
+	"Time since the resource cache of a namespace of an account was last refreshed.",
+	[]string{"account", "namespace"}, nil)
@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func counterValue(t *testing.T, counter prometheus.Counter) float64 {
+	t.Helper()
+
+	var m dto.Metric
+	if err := counter.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	return m.GetCounter().GetValue()
+}
+
+func TestObserveNamespaceScrape(t *testing.T) {
+	observeNamespaceScrape("production", "SYS.ELB", 2*time.Second, 3, nil)
+	for gauge, want := range map[*prometheus.GaugeVec]float64{namespaceScrapeDuration: 2, namespaceScrapeSuccess: 1, namespaceSeries: 3} {
+		if got, _ := metricValue(gauge.WithLabelValues("production", "SYS.ELB")); got != want {
+			t.Errorf("%s = %v, want %v", gauge.WithLabelValues("production", "SYS.ELB").Desc(), got, want)
+		}
+	}
+
+	observeNamespaceScrape("production", "SYS.ELB", time.Second, 0, errors.New("timeout"))
+	if got, _ := metricValue(namespaceScrapeSuccess.WithLabelValues("production", "SYS.ELB")); got != 0 {
+		t.Errorf("namespace_scrape_success = %v, want 0 after a failure", got)
+	}
+}
+
+func TestInstrumentedTransport(t *testing.T) {
+	responses := []func() (*http.Response, error){
+		func() (*http.Response, error) { return newResponse(http.StatusOK, nil), nil },
+		func() (*http.Response, error) { return newResponse(http.StatusServiceUnavailable, nil), nil },
+		func() (*http.Response, error) { return nil, errors.New("connection reset") },
+	}
+	attempt := 0
+	transport := &instrumentedTransport{next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempt++
+		return responses[attempt-1]()
+	})}
+
+	// the counters are global, only their increase is checked
+	codes := []string{"200", "503", "error"}
+	before := make(map[string]float64)
+	for _, code := range codes {
+		before[code] = counterValue(t, apiRequests.WithLabelValues("INSTRUMENTED", code))
+	}
+	errorsBefore := counterValue(t, apiRequestErrors.WithLabelValues("INSTRUMENTED"))
+
+	for range responses {
+		req, _ := http.NewRequest(http.MethodGet, "https://instrumented.eu-de.example.com/v1/resources", nil)
+		_, _ = transport.RoundTrip(req)
+	}
+
+	for _, code := range codes {
+		if got := counterValue(t, apiRequests.WithLabelValues("INSTRUMENTED", code)) - before[code]; got != 1 {
+			t.Errorf("api_requests_total{code=%q} increased by %v, want 1", code, got)
+		}
+	}
+	if got := counterValue(t, apiRequestErrors.WithLabelValues("INSTRUMENTED")) - errorsBefore; got != 2 {
+		t.Errorf("api_request_errors_total increased by %v, want 2", got)
+	}
+}
+
+func TestObserveConfigReload(t *testing.T) {
+	ObserveConfigReload(nil)
+	if got, _ := metricValue(configLastReloadSuccessful); got != 1 {
+		t.Errorf("config_last_reload_successful = %v, want 1", got)
+	}
+	succeededAt, _ := metricValue(configLastReloadSuccessTimestamp)
+
+	ObserveConfigReload(errors.New("invalid configuration"))
+	if got, _ := metricValue(configLastReloadSuccessful); got != 0 {
+		t.Errorf("config_last_reload_successful = %v, want 0", got)
+	}
+	if got, _ := metricValue(configLastReloadSuccessTimestamp); got != succeededAt || got == 0 {
+		t.Errorf("config_last_reload_success_timestamp_seconds = %v, want the time of the last success %v", got, succeededAt)
+	}
+}
@@ -3,96 +3,233 @@ package collector
 import (
 	"context"
 	"fmt"
+	"github.com/akyriako/cloudeye-exporter/config"
 	"github.com/huaweicloud/golangsdk/openstack/ces/v1/metricdata"
 	"github.com/huaweicloud/golangsdk/openstack/ces/v1/metrics"
 	"github.com/prometheus/client_golang/prometheus"
 	"log/slog"
+	"slices"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
-func (c *CloudEyeExporter) collectMetricsByNamespace(ctx context.Context, ch chan<- prometheus.Metric, namespace string) {
+func (c *CloudEyeExporter) collectMetricsByNamespace(ctx context.Context, ch chan<- prometheus.Metric, namespace string) (err error) {
 	defer func() {
-		if err := recover(); err != nil {
-			slog.Error("fatal error occurred during collecting metrics: %s", err)
+		if r := recover(); r != nil {
+			slog.Error(fmt.Sprintf("fatal error occurred during collecting metrics: %s", r))
+			err = newNamespaceError(reasonPanic, fmt.Errorf("%s", r))
 		}
 	}()
 
-	allMetrics, allResourcesInfo := c.getAllMetricsAndResourcesByNamespace(namespace)
+	allResourcesInfo, filterMetrics, resourcesErr := c.getAllResources(ctx, namespace)
+	if ctx.Err() != nil {
+		return newNamespaceError(reasonTimeout, ctx.Err())
+	}
+	if resourcesErr != nil && allResourcesInfo == nil {
+		return newNamespaceError(reasonListResources, resourcesErr)
+	}
+	slog.Debug(fmt.Sprintf("[%s] found %d resources in %s: ", c.txnKey, len(allResourcesInfo), namespace))
+
+	// expired resources are still served, the failure to refresh them is
+	// reported once the metrics are collected
+	defer func() {
+		if err == nil && resourcesErr != nil {
+			err = newNamespaceError(reasonListResources, resourcesErr)
+		}
+	}()
+
+	allMetrics, err := c.getAllMetricsByNamespace(namespace, filterMetrics)
+	if ctx.Err() != nil {
+		return newNamespaceError(reasonTimeout, ctx.Err())
+	}
+	if err != nil {
+		return newNamespaceError(reasonListMetrics, err)
+	}
 	if len(allMetrics) == 0 {
 		slog.Warn(fmt.Sprintf("[%s] no metrics on %s were found", c.txnKey, namespace))
-		return
+		return nil
 	}
 
 	slog.Debug(fmt.Sprintf("[%s] scraping metric data", c.txnKey))
 	workChan := make(chan struct{}, c.MaxRoutines)
 	defer close(workChan)
 	var wg sync.WaitGroup
-	count := 0
-	tmpMetrics := make([]metricdata.Metric, 0, c.ScrapeBatchSize)
+	var failedBatches, panickedBatches, batches atomic.Int32
+	infos := newResourceInfoSet()
 
-	for _, metric := range allMetrics {
-		count++
-		tmpMetrics = append(tmpMetrics, metricsToMetricData(metric))
-		if (len(tmpMetrics) == c.ScrapeBatchSize) || (count == len(allMetrics)) {
-			workChan <- struct{}{}
-			wg.Add(1)
-			go func(tmpMetrics []metricdata.Metric) {
-				defer func() {
-					<-workChan
-					wg.Done()
-				}()
-
-				slog.Debug(fmt.Sprintf("[%s] getting batch metric data, metric count: %d", c.txnKey, len(tmpMetrics)))
-				dataList, err := c.getBatchMetricData(&tmpMetrics, c.From, c.To)
-				if err != nil {
-					return
+	for group, groupMetrics := range c.groupMetricsByQueryOptions(namespace, allMetrics) {
+		count := 0
+		tmpMetrics := make([]metricdata.Metric, 0, c.ScrapeBatchSize)
+
+		for _, metric := range groupMetrics {
+			count++
+			tmpMetrics = append(tmpMetrics, metric)
+			if (len(tmpMetrics) == c.ScrapeBatchSize) || (count == len(groupMetrics)) {
+				if ctx.Err() != nil {
+					// the scrape was given up, the remaining batches are skipped
+					batches.Add(1)
+					failedBatches.Add(1)
+					tmpMetrics = make([]metricdata.Metric, 0, c.ScrapeBatchSize)
+					continue
 				}
-				c.pushMetricsData(ctx, ch, *dataList, allResourcesInfo)
-			}(tmpMetrics)
-			tmpMetrics = make([]metricdata.Metric, 0, c.ScrapeBatchSize)
+
+				workChan <- struct{}{}
+				wg.Add(1)
+				batches.Add(1)
+				go func(tmpMetrics []metricdata.Metric, group queryGroup) {
+					defer func() {
+						// the recovery of the namespace does not reach into
+						// the batch goroutines
+						if r := recover(); r != nil {
+							slog.Error(fmt.Sprintf("[%s] fatal error occurred during pushing batch metric data: %s", c.txnKey, r))
+							panickedBatches.Add(1)
+						}
+						<-workChan
+						wg.Done()
+					}()
+
+					slog.Debug(fmt.Sprintf("[%s] getting batch metric data, metric count: %d", c.txnKey, len(tmpMetrics)))
+					dataList, err := c.getBatchMetricData(&tmpMetrics, group)
+					if err != nil {
+						failedBatches.Add(1)
+						return
+					}
+					c.pushMetricsData(ctx, ch, *dataList, group, allResourcesInfo, infos)
+				}(tmpMetrics, group)
+				tmpMetrics = make([]metricdata.Metric, 0, c.ScrapeBatchSize)
+			}
 		}
 	}
 
 	wg.Wait()
 	slog.Debug(fmt.Sprintf("[%s] scraped all metric data", c.txnKey))
+
+	if panickedBatches.Load() > 0 {
+		return newNamespaceError(reasonPanic, fmt.Errorf("%d of %d batches panicked", panickedBatches.Load(), batches.Load()))
+	}
+
+	if failedBatches.Load() > 0 && ctx.Err() != nil {
+		return newNamespaceError(reasonTimeout, fmt.Errorf("%d of %d batch queries not completed: %w", failedBatches.Load(), batches.Load(), ctx.Err()))
+	}
+
+	if failedBatches.Load() > 0 {
+		return newNamespaceError(reasonBatchQuery, fmt.Errorf("%d of %d batch queries failed", failedBatches.Load(), batches.Load()))
+	}
+
+	return nil
 }
 
-func (c *CloudEyeExporter) getAllMetricsAndResourcesByNamespace(namespace string) ([]metrics.Metric, map[string][]string) {
-	allResourcesInfo, filterMetrics := c.getAllResources(namespace)
-	slog.Debug(fmt.Sprintf("[%s] found %d resources in %s: ", c.txnKey, len(allResourcesInfo), namespace))
+// queryGroup is a set of metrics that can be requested in the same batch
+// query, as a batch query can only be issued for a single window, period and
+// filter. Suffix and Aggregation are set when more than one filter is
+// exported for a metric, depending on the aggregation mode.
+type queryGroup struct {
+	Window      time.Duration
+	Period      int
+	Filter      string
+	Suffix      string
+	Aggregation string
+}
+
+// groupMetricsByQueryOptions groups the metrics of a namespace by their query
+// options, a metric with additional filters is added to one group per filter.
+func (c *CloudEyeExporter) groupMetricsByQueryOptions(namespace string, allMetrics []metrics.Metric) map[queryGroup][]metricdata.Metric {
+	groups := make(map[queryGroup][]metricdata.Metric)
+	for _, metric := range allMetrics {
+		options := c.CloudConfig.GetQueryOptions(namespace, metric.MetricName).Merge(c.QueryOverrides)
+		for _, group := range c.getQueryGroups(options) {
+			groups[group] = append(groups[group], metricsToMetricData(metric))
+		}
+	}
+
+	return groups
+}
 
-	if len(*filterMetrics) > 0 {
-		return *filterMetrics, allResourcesInfo
+func (c *CloudEyeExporter) getQueryGroups(options config.QueryOptions) []queryGroup {
+	primary := queryGroup{
+		Window: options.Window,
+		Period: options.Period,
+		Filter: options.Filter,
+	}
+
+	additionalFilters := make([]string, 0, len(options.AdditionalFilters))
+	for _, filter := range options.AdditionalFilters {
+		if filter != options.Filter && !slices.Contains(additionalFilters, filter) {
+			additionalFilters = append(additionalFilters, filter)
+		}
+	}
+
+	if len(additionalFilters) == 0 {
+		return []queryGroup{primary}
+	}
+
+	labelMode := c.CloudConfig.Global.AggregationMode == config.AggregationModeLabel
+	if labelMode {
+		primary.Aggregation = primary.Filter
+	}
+
+	groups := []queryGroup{primary}
+	for _, filter := range additionalFilters {
+		group := queryGroup{
+			Window: options.Window,
+			Period: options.Period,
+			Filter: filter,
+		}
+		if labelMode {
+			group.Aggregation = filter
+		} else {
+			group.Suffix = filter
+		}
+		groups = append(groups, group)
+	}
+
+	return groups
+}
+
+// getAllMetricsByNamespace returns the metrics built from the resources, if
+// there are any, or else the ones listed from CES.
+func (c *CloudEyeExporter) getAllMetricsByNamespace(namespace string, filterMetrics []metrics.Metric) ([]metrics.Metric, error) {
+	if len(filterMetrics) > 0 {
+		return c.filterIncludedMetrics(namespace, filterMetrics), nil
 	}
 
 	slog.Debug(fmt.Sprintf("[%s] collecting all metrics from CES", c.txnKey))
 	allMetrics, err := c.getAllMetrics(namespace)
 	if err != nil {
 		slog.Error(fmt.Sprintf("[%s] collecting all metrics failed: %s", c.txnKey, err.Error()))
-		return nil, nil
+		return nil, err
 	}
 	slog.Debug(fmt.Sprintf("[%s] number of collected metrics: %d", c.txnKey, len(*allMetrics)))
-	return *allMetrics, allResourcesInfo
+	return c.filterIncludedMetrics(namespace, *allMetrics), nil
 }
 
-func (c *CloudEyeExporter) getBatchMetricData(metrics *[]metricdata.Metric, from string, to string) (*[]metricdata.MetricData, error) {
-	ifrom, err := strconv.ParseInt(from, 10, 64)
-	if err != nil {
-		slog.Error(fmt.Sprintf("parse failed: %s", err.Error()))
-		return nil, err
-	}
-	ito, err := strconv.ParseInt(to, 10, 64)
-	if err != nil {
-		slog.Error(fmt.Sprintf("parse failed: %s", err.Error()))
-		return nil, err
+// filterIncludedMetrics returns the metrics passing the include and exclude
+// rules of the metric filters, leaving allMetrics untouched.
+func (c *CloudEyeExporter) filterIncludedMetrics(namespace string, allMetrics []metrics.Metric) []metrics.Metric {
+	included := make([]metrics.Metric, 0, len(allMetrics))
+	for _, metric := range allMetrics {
+		dimensionNames := make([]string, 0, len(metric.Dimensions))
+		for _, dimension := range metric.Dimensions {
+			dimensionNames = append(dimensionNames, dimension.Name)
+		}
+
+		if c.CloudConfig.IsMetricIncluded(namespace, metric.MetricName, dimensionNames) {
+			included = append(included, metric)
+		}
 	}
+
+	return included
+}
+
+func (c *CloudEyeExporter) getBatchMetricData(metrics *[]metricdata.Metric, group queryGroup) (*[]metricData, error) {
 	options := metricdata.BatchQueryOpts{
 		Metrics: *metrics,
-		From:    ifrom,
-		To:      ito,
-		Period:  "1",
-		Filter:  "average",
+		From:    c.now.Add(-group.Window).UnixMilli(),
+		To:      c.now.UnixMilli(),
+		Period:  strconv.Itoa(group.Period),
+		Filter:  group.Filter,
 	}
 
 	client, err := c.Client.GetCESClient()
@@ -101,13 +238,18 @@ func (c *CloudEyeExporter) getBatchMetricData(metrics *[]metricdata.Metric, from
 		return nil, err
 	}
 
-	v, err := metricdata.BatchQuery(client, options).ExtractMetricDatas()
+	// the datapoints are extracted in metricData instead of metricdata.MetricData,
+	// the latter only keeps the average of every datapoint
+	var v struct {
+		MetricDatas []metricData `json:"metrics"`
+	}
+	err = metricdata.BatchQuery(client, options).ExtractInto(&v)
 	if err != nil {
 		slog.Error(fmt.Sprintf("collecting metricdata from batch query failed: %s", err.Error()))
 		return nil, err
 	}
 
-	return &v, nil
+	return &v.MetricDatas, nil
 }
 
 func (c *CloudEyeExporter) getAllMetrics(namespace string) (*[]metrics.Metric, error) {
@@ -136,9 +278,18 @@ func (c *CloudEyeExporter) getAllMetrics(namespace string) (*[]metrics.Metric, e
 func (c *CloudEyeExporter) pushMetricsData(
 	ctx context.Context,
 	ch chan<- prometheus.Metric,
-	dataList []metricdata.MetricData,
+	dataList []metricData,
+	group queryGroup,
 	allResourcesInfo map[string][]string,
+	infos *resourceInfoSet,
 ) {
+	infoMode := c.CloudConfig.Global.LabelMode == config.LabelModeInfo
+	// the metrics of a batch all belong to the namespace being collected
+	var tagLabels []string
+	if len(dataList) > 0 {
+		tagLabels = c.tagLabelNames(dataList[0].Namespace)
+	}
+
 	for _, metric := range dataList {
 		_, err := validateMetricData(metric)
 		if err != nil {
@@ -146,22 +297,47 @@ func (c *CloudEyeExporter) pushMetricsData(
 		}
 		//slog.Debug(fmt.Sprintf("[%s] validated metric: %s", c.txnKey, string(dataJson)))
 
-		data, err := getLatestData(metric.Datapoints)
+		data, err := getLatestData(metric.Datapoints, group.Filter)
 		if err != nil {
 			slog.Warn(fmt.Sprintf("[%s] getting latest data failed: %s, metric_name: %s, dimension: %+v", c.txnKey, err.Error(), metric.MetricName, metric.Dimensions))
 			continue
 		}
 
-		labelInfo, err := relabelMetricData(allResourcesInfo, metric)
+		labelInfo, err := relabelMetricData(allResourcesInfo, metric, !infoMode, tagLabels)
 		if err != nil {
 			slog.Error(fmt.Sprintf("[%s] %s", c.txnKey, err.Error()))
 			continue
 		}
 
-		fqName := prometheus.BuildFQName(getMetricPrefixName(c.Prefix, metric.Namespace), labelInfo.PreResourceName, metric.MetricName)
-		proMetric := prometheus.MustNewConstMetric(
-			prometheus.NewDesc(fqName, fqName, labelInfo.Labels, nil),
+		if infoMode {
+			infoMetric, err := c.getResourceInfoMetric(allResourcesInfo, metric, infos)
+			if err != nil {
+				slog.Error(fmt.Sprintf("[%s] %s", c.txnKey, err.Error()))
+			} else if infoMetric != nil {
+				if err := pushMetricData(ctx, ch, infoMetric); err != nil {
+					slog.Error(fmt.Sprintf("[%s] context cancellation detected while push info metric of: %s", c.txnKey, metric.Namespace))
+				}
+			}
+		}
+
+		if group.Aggregation != "" {
+			labelInfo.Labels = append(labelInfo.Labels, "aggregation")
+			labelInfo.Values = append(labelInfo.Values, group.Aggregation)
+		}
+
+		metricName := metric.MetricName
+		if group.Suffix != "" {
+			metricName = fmt.Sprintf("%s_%s", metricName, group.Suffix)
+		}
+
+		fqName := prometheus.BuildFQName(getMetricPrefixName(c.Prefix, metric.Namespace), labelInfo.PreResourceName, metricName)
+		proMetric, err := prometheus.NewConstMetric(
+			prometheus.NewDesc(fqName, fqName, labelInfo.Labels, c.constLabels()),
 			prometheus.GaugeValue, data, labelInfo.Values...)
+		if err != nil {
+			slog.Error(fmt.Sprintf("[%s] building metric %s failed: %s", c.txnKey, fqName, err.Error()))
+			continue
+		}
 		if err := pushMetricData(ctx, ch, proMetric); err != nil {
 			slog.Error(fmt.Sprintf("[%s] context cancellation detected while push metric: %s", c.txnKey, fqName))
 		}
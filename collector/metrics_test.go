@@ -0,0 +1,103 @@
+package collector
+
+import (
+	"context"
+	"github.com/akyriako/cloudeye-exporter/config"
+	"github.com/huaweicloud/golangsdk/openstack/ces/v1/metricdata"
+	"github.com/prometheus/client_golang/prometheus"
+	"regexp"
+	"testing"
+)
+
+var fqNamePattern = regexp.MustCompile(`fqName: "([^"]+)"`)
+
+// getSeries returns a metric as its name, followed by its aggregation label
+// if it has one, and its value.
+func getSeries(t *testing.T, metric prometheus.Metric) (string, float64) {
+	t.Helper()
+
+	value, err := metricValue(metric)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	series := fqNamePattern.FindStringSubmatch(metric.Desc().String())[1]
+	if aggregation, ok := getLabels(t, metric)["aggregation"]; ok {
+		series += "{aggregation=" + aggregation + "}"
+	}
+
+	return series, value
+}
+
+func TestPushMetricsDataAggregation(t *testing.T) {
+	data := metricData{
+		Namespace:  "SYS.ELB",
+		MetricName: "m1_cps",
+		Dimensions: []metricdata.Dimension{{Name: "lbaas_instance_id", Value: "lb-1"}},
+		Datapoints: []datapoint{{Average: 1, Max: 5, Min: 0, Sum: 10}},
+	}
+	resourcesInfo := map[string][]string{"lb-1": {"web", "vlb", "10.0.0.1"}}
+
+	tests := []struct {
+		name    string
+		mode    string
+		options config.QueryOptions
+		want    map[string]float64
+	}{
+		{
+			name:    "single filter",
+			mode:    config.AggregationModeSuffix,
+			options: config.QueryOptions{Filter: "max"},
+			want:    map[string]float64{"opentelekomcloud_sys_elb_m1_cps": 5},
+		},
+		{
+			name:    "suffix",
+			mode:    config.AggregationModeSuffix,
+			options: config.QueryOptions{Filter: "average", AdditionalFilters: []string{"max", "average", "sum"}},
+			want: map[string]float64{
+				"opentelekomcloud_sys_elb_m1_cps":     1,
+				"opentelekomcloud_sys_elb_m1_cps_max": 5,
+				"opentelekomcloud_sys_elb_m1_cps_sum": 10,
+			},
+		},
+		{
+			name:    "label",
+			mode:    config.AggregationModeLabel,
+			options: config.QueryOptions{Filter: "average", AdditionalFilters: []string{"max"}},
+			want: map[string]float64{
+				"opentelekomcloud_sys_elb_m1_cps{aggregation=average}": 1,
+				"opentelekomcloud_sys_elb_m1_cps{aggregation=max}":     5,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := &CloudEyeExporter{
+				CloudConfig: &config.CloudConfig{Global: config.Global{AggregationMode: tt.mode}},
+				Prefix:      "opentelekomcloud",
+			}
+
+			ch := make(chan prometheus.Metric, 10)
+			for _, group := range exporter.getQueryGroups(tt.options) {
+				exporter.pushMetricsData(context.Background(), ch, []metricData{data}, group, resourcesInfo, newResourceInfoSet())
+			}
+			close(ch)
+
+			got := make(map[string]float64)
+			for metric := range ch {
+				series, value := getSeries(t, metric)
+				got[series] = value
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("series = %v, want %v", got, tt.want)
+			}
+			for series, value := range tt.want {
+				if got[series] != value {
+					t.Errorf("%s = %v, want %v", series, got[series], value)
+				}
+			}
+		})
+	}
+}
@@ -3,12 +3,50 @@ package collector
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/huaweicloud/golangsdk/openstack/ces/v1/metricdata"
 	"github.com/huaweicloud/golangsdk/openstack/ces/v1/metrics"
 	"github.com/prometheus/client_golang/prometheus"
 	"unsafe"
 )
 
+// metricData mirrors metricdata.MetricData, but keeps every aggregation CES
+// may return for a datapoint.
+type metricData struct {
+	Namespace  string                 `json:"namespace"`
+	MetricName string                 `json:"metric_name"`
+	Dimensions []metricdata.Dimension `json:"dimensions"`
+	Datapoints []datapoint            `json:"datapoints"`
+	Unit       string                 `json:"unit"`
+}
+
+type datapoint struct {
+	Average   float64 `json:"average"`
+	Max       float64 `json:"max"`
+	Min       float64 `json:"min"`
+	Sum       float64 `json:"sum"`
+	Variance  float64 `json:"variance"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+func (d datapoint) valueOf(filter string) (float64, error) {
+	switch filter {
+	case "average":
+		return d.Average, nil
+	case "max":
+		return d.Max, nil
+	case "min":
+		return d.Min, nil
+	case "sum":
+		return d.Sum, nil
+	case "variance":
+		return d.Variance, nil
+	default:
+		return 0, fmt.Errorf("unknown filter: %s", filter)
+	}
+}
+
 func metricsToMetricData(metric metrics.Metric) metricdata.Metric {
 	var m metricdata.Metric
 	m.Namespace = metric.Namespace
@@ -34,7 +72,28 @@ func buildSingleDimensionMetrics(metricNames []string, namespace, dimName, dimVa
 	return filterMetrics
 }
 
-func validateMetricData(md metricdata.MetricData) ([]byte, error) {
+func buildDoubleDimensionMetrics(metricNames []string, namespace, dimName, dimValue, subDimName, subDimValue string) []metrics.Metric {
+	filterMetrics := make([]metrics.Metric, 0)
+	for index := range metricNames {
+		filterMetrics = append(filterMetrics, metrics.Metric{
+			Namespace:  namespace,
+			MetricName: metricNames[index],
+			Dimensions: []metrics.Dimension{
+				{
+					Name:  dimName,
+					Value: dimValue,
+				},
+				{
+					Name:  subDimName,
+					Value: subDimValue,
+				},
+			},
+		})
+	}
+	return filterMetrics
+}
+
+func validateMetricData(md metricData) ([]byte, error) {
 	dataJson, err := json.Marshal(md)
 	if err != nil {
 		return nil, err
@@ -44,13 +103,10 @@ func validateMetricData(md metricdata.MetricData) ([]byte, error) {
 }
 
 func pushMetricData(ctx context.Context, ch chan<- prometheus.Metric, metric prometheus.Metric) error {
-	// Check whether the Context is cancelled
-	select {
-	case _, ok := <-ctx.Done():
-		if !ok {
-			return ctx.Err()
-		}
-	default: // continue
+	// Check whether the Context is cancelled, an exceeded deadline still lets
+	// the metric through, as whatever was collected until then is served
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return ctx.Err()
 	}
 	// If no, send the metric
 	ch <- metric
@@ -0,0 +1,199 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"github.com/akyriako/cloudeye-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type snapshot struct {
+	Metrics     []prometheus.Metric
+	CollectedAt time.Time
+}
+
+// Poller collects the configured namespaces in the background, each one on
+// its own interval, and keeps the last completed collection as a snapshot, so
+// that scrapes can be served without waiting on CES.
+type Poller struct {
+	cloudConfig *config.CloudConfig
+	clientPool  *ClientPool
+	snapshots   map[string]*snapshot
+	sync.RWMutex
+}
+
+func NewPoller(cloudConfig *config.CloudConfig, clientPool *ClientPool) *Poller {
+	return &Poller{
+		cloudConfig: cloudConfig,
+		clientPool:  clientPool,
+		snapshots:   make(map[string]*snapshot),
+	}
+}
+
+// Reload returns the poller of a reloaded configuration, keeping the snapshots
+// of the namespaces still polled for the accounts whose credentials did not
+// change, as long as the prefix did not change either.
+func (p *Poller) Reload(cloudConfig *config.CloudConfig, clientPool *ClientPool) *Poller {
+	p.RLock()
+	defer p.RUnlock()
+
+	poller := NewPoller(cloudConfig, clientPool)
+	if p.cloudConfig.Global.Prefix != cloudConfig.Global.Prefix {
+		return poller
+	}
+
+	for _, account := range cloudConfig.Accounts {
+		previous, err := p.cloudConfig.GetAccount(account.Name)
+		if err != nil || getClientPoolKey(previous.Auth) != getClientPoolKey(account.Auth) {
+			continue
+		}
+		for _, pollingNamespace := range cloudConfig.Global.Polling.Namespaces {
+			key := getSnapshotKey(account.Name, pollingNamespace.Namespace)
+			if s, ok := p.snapshots[key]; ok && poller.IsPolled(account.Name, pollingNamespace.Namespace) {
+				poller.snapshots[key] = s
+			}
+		}
+	}
+
+	return poller
+}
+
+// Start polls every configured namespace for its account, or for all the
+// accounts if the namespace is not bound to one.
+func (p *Poller) Start(ctx context.Context) {
+	for _, pollingNamespace := range p.cloudConfig.Global.Polling.Namespaces {
+		for i := range p.cloudConfig.Accounts {
+			account := &p.cloudConfig.Accounts[i]
+			if pollingNamespace.Account != "" && pollingNamespace.Account != account.Name {
+				continue
+			}
+			go p.poll(ctx, account, pollingNamespace.Namespace, pollingNamespace.Interval)
+		}
+	}
+}
+
+func (p *Poller) IsPolled(account string, namespace string) bool {
+	for _, pollingNamespace := range p.cloudConfig.Global.Polling.Namespaces {
+		if pollingNamespace.Namespace != namespace {
+			continue
+		}
+		if pollingNamespace.Account == "" || pollingNamespace.Account == account {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Collector returns a collector serving the last completed snapshots of the
+// given namespaces of an account.
+func (p *Poller) Collector(account string, namespaces []string) prometheus.Collector {
+	p.RLock()
+	defer p.RUnlock()
+
+	snapshots := make(map[string]*snapshot)
+	for _, namespace := range namespaces {
+		if s, ok := p.snapshots[getSnapshotKey(account, namespace)]; ok {
+			snapshots[namespace] = s
+		}
+	}
+
+	constLabels := prometheus.Labels{"account": account}
+	if a, err := p.cloudConfig.GetAccount(account); err == nil {
+		constLabels = getConstLabels(a)
+	}
+
+	return &snapshotCollector{
+		prefix:      p.cloudConfig.Global.Prefix,
+		constLabels: constLabels,
+		snapshots:   snapshots,
+	}
+}
+
+func (p *Poller) poll(ctx context.Context, account *config.Account, namespace string, interval time.Duration) {
+	slog.Info(fmt.Sprintf("polling %s of account %s every %s", namespace, account.Name, interval))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.refresh(ctx, account, namespace, interval)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh collects a namespace of an account, a collection taking longer than
+// the polling interval is cut short and its partial result is kept. When no
+// client can be acquired for the account, the snapshot only reports the
+// namespace as down.
+func (p *Poller) refresh(ctx context.Context, account *config.Account, namespace string, interval time.Duration) {
+	s := &snapshot{}
+
+	cloudEyeExporter, err := NewCloudEyeExporter(ctx, p.cloudConfig, p.clientPool, account, []string{namespace})
+	if err != nil {
+		slog.Error(fmt.Sprintf("polling %s of account %s failed: %s", namespace, account.Name, err.Error()))
+		err = newNamespaceError(reasonClient, err)
+		s.Metrics = []prometheus.Metric{newNamespaceUpMetric(p.cloudConfig.Global, getConstLabels(account), namespace, err)}
+	} else {
+		cloudEyeExporter.Timeout = interval
+		s.Metrics = collectAll(cloudEyeExporter)
+	}
+	s.CollectedAt = time.Now()
+
+	p.Lock()
+	p.snapshots[getSnapshotKey(account.Name, namespace)] = s
+	p.Unlock()
+
+	slog.Debug(fmt.Sprintf("polled %s of account %s, metric count: %d", namespace, account.Name, len(s.Metrics)))
+}
+
+func getSnapshotKey(account string, namespace string) string {
+	return fmt.Sprintf("%s/%s", account, namespace)
+}
+
+func collectAll(collector prometheus.Collector) []prometheus.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(ch)
+		close(ch)
+	}()
+
+	all := make([]prometheus.Metric, 0)
+	for metric := range ch {
+		all = append(all, metric)
+	}
+
+	return all
+}
+
+type snapshotCollector struct {
+	prefix      string
+	constLabels prometheus.Labels
+	snapshots   map[string]*snapshot
+}
+
+// Describe sends no descriptor, the metrics of the snapshots are only known
+// at collection time.
+func (s *snapshotCollector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+func (s *snapshotCollector) Collect(ch chan<- prometheus.Metric) {
+	fqName := prometheus.BuildFQName(s.prefix, "", "snapshot_age_seconds")
+	desc := prometheus.NewDesc(fqName, "Age of the last completed background collection of a namespace.", []string{"namespace"}, s.constLabels)
+
+	for namespace, snapshot := range s.snapshots {
+		for _, metric := range snapshot.Metrics {
+			ch <- metric
+		}
+
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, time.Since(snapshot.CollectedAt).Seconds(), namespace)
+	}
+}
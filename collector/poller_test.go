@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"context"
+	"github.com/akyriako/cloudeye-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"testing"
+	"time"
+)
+
+func newTestPollerConfig(accounts ...config.Account) *config.CloudConfig {
+	cloudConfig := newTestConfig(accounts...)
+	cloudConfig.Global.Prefix = "opentelekomcloud"
+	cloudConfig.Global.Retry.MaxRetries = retries(0)
+	cloudConfig.Global.Polling = config.Polling{
+		Enabled:    true,
+		Namespaces: []config.PollingNamespace{{Namespace: "SYS.ELB"}},
+	}
+
+	return cloudConfig
+}
+
+func getLabels(t *testing.T, metric prometheus.Metric) map[string]string {
+	t.Helper()
+
+	var m dto.Metric
+	if err := metric.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+
+	labels := make(map[string]string)
+	for _, label := range m.GetLabel() {
+		labels[label.GetName()] = label.GetValue()
+	}
+
+	return labels
+}
+
+func TestPollerRefreshWithoutClient(t *testing.T) {
+	account := config.Account{Name: "production", Auth: config.CloudAuth{
+		AuthURL:     "http://127.0.0.1:1/v3",
+		ProjectName: "eu-de_production",
+		AccessKey:   "ak",
+		SecretKey:   "sk",
+		Region:      "eu-de",
+	}}
+	cloudConfig := newTestPollerConfig(account)
+	poller := NewPoller(cloudConfig, NewClientPool(cloudConfig))
+
+	poller.refresh(context.Background(), &cloudConfig.Accounts[0], "SYS.ELB", time.Minute)
+
+	metrics := collectAll(poller.Collector("production", []string{"SYS.ELB"}))
+	if len(metrics) != 2 {
+		t.Fatalf("got %d metrics, want namespace_up and snapshot_age_seconds", len(metrics))
+	}
+
+	up, err := metricValue(metrics[0])
+	if err != nil || up != 0 {
+		t.Errorf("namespace_up = %v, %v, want 0", up, err)
+	}
+	want := map[string]string{"account": "production", "project": "eu-de_production", "region": "eu-de", "namespace": "SYS.ELB"}
+	for i, metric := range metrics {
+		labels := getLabels(t, metric)
+		for name, value := range want {
+			if labels[name] != value {
+				t.Errorf("metric %d labels = %v, want %s=%s", i, labels, name, value)
+			}
+		}
+	}
+	if reason := getLabels(t, metrics[0])["reason"]; reason != reasonClient {
+		t.Errorf("reason = %s, want %s", reason, reasonClient)
+	}
+}
+
+func TestPollerReload(t *testing.T) {
+	production := config.Account{Name: "production", Auth: config.CloudAuth{ProjectName: "production", AccessKey: "ak"}}
+	staging := config.Account{Name: "staging", Auth: config.CloudAuth{ProjectName: "staging", AccessKey: "ak"}}
+
+	cloudConfig := newTestPollerConfig(production, staging)
+	poller := NewPoller(cloudConfig, NewClientPool(cloudConfig))
+	for _, account := range []string{"production", "staging"} {
+		poller.snapshots[getSnapshotKey(account, "SYS.ELB")] = &snapshot{CollectedAt: time.Now()}
+	}
+
+	rotated := staging
+	rotated.Auth.AccessKey = "rotated"
+	reloaded := poller.Reload(newTestPollerConfig(production, rotated), nil)
+	if _, ok := reloaded.snapshots[getSnapshotKey("production", "SYS.ELB")]; !ok || len(reloaded.snapshots) != 1 {
+		t.Errorf("snapshots = %v, want only the snapshot of the unchanged account", reloaded.snapshots)
+	}
+
+	unpolled := newTestPollerConfig(production, rotated)
+	unpolled.Global.Polling.Namespaces = []config.PollingNamespace{{Namespace: "SYS.RDS"}}
+	if again := reloaded.Reload(unpolled, nil); len(again.snapshots) != 0 {
+		t.Errorf("snapshots = %v, want none of the namespaces no longer polled", again.snapshots)
+	}
+
+	renamed := newTestPollerConfig(production, rotated)
+	renamed.Global.Prefix = "otc"
+	if again := reloaded.Reload(renamed, nil); len(again.snapshots) != 0 {
+		t.Errorf("snapshots = %v, want none after the prefix changed", again.snapshots)
+	}
+}
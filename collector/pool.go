@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/akyriako/cloudeye-exporter/config"
+	"log/slog"
+	"reflect"
+	"sync"
+)
+
+// ClientPool keeps the authenticated OpenTelekomCloudClients alive across
+// scrapes, so that IAM is only contacted when a client is built for the first
+// time or when its token has to be renewed. Clients are keyed by their
+// credentials, project and region. The pool also owns the cache of the
+// resources discovered with these clients.
+type ClientPool struct {
+	cloudConfig *config.CloudConfig
+	clients     map[string]*pooledClient
+	transport   *reloadableTransport
+	resources   *ResourceCache
+	sync.Mutex
+}
+
+func NewClientPool(cloudConfig *config.CloudConfig) *ClientPool {
+	return &ClientPool{
+		cloudConfig: cloudConfig,
+		clients:     make(map[string]*pooledClient),
+		transport:   newReloadableTransport(NewTransport(cloudConfig.Global)),
+		resources:   NewResourceCache(),
+	}
+}
+
+// Reload returns the pool of a reloaded configuration, taking over what is
+// still valid of p: the clients of the accounts whose credentials did not
+// change, the transport unless the retry policy or the rate limits changed,
+// and the resources of the unchanged accounts unless the metric filters, the
+// tag labels or the resource ttls changed.
+func (p *ClientPool) Reload(cloudConfig *config.CloudConfig) *ClientPool {
+	p.Lock()
+	defer p.Unlock()
+
+	pool := &ClientPool{
+		cloudConfig: cloudConfig,
+		clients:     make(map[string]*pooledClient),
+		transport:   p.transport,
+		resources:   p.resources,
+	}
+
+	previous := p.cloudConfig.Global
+	if !reflect.DeepEqual(previous.Retry, cloudConfig.Global.Retry) || !reflect.DeepEqual(previous.RateLimits, cloudConfig.Global.RateLimits) {
+		// the pooled clients keep sending through the same transport, only
+		// the policies behind it are replaced
+		slog.Info("retry policy or rate limits changed, replacing the transport")
+		pool.transport.replace(NewTransport(cloudConfig.Global))
+	}
+
+	unchanged := make(map[string]bool)
+	for _, account := range cloudConfig.Accounts {
+		key := getClientPoolKey(account.Auth)
+		if client, ok := p.clients[key]; ok {
+			pool.clients[key] = client
+		}
+
+		if previousAccount, err := p.cloudConfig.GetAccount(account.Name); err == nil && getClientPoolKey(previousAccount.Auth) == key {
+			unchanged[account.Name] = true
+		}
+	}
+
+	if !p.cloudConfig.ListsResourcesLike(cloudConfig) {
+		slog.Info("metric filters, tag labels or resource ttls changed, dropping the cached resources")
+		pool.resources = NewResourceCache()
+	} else {
+		pool.resources.retain(unchanged)
+	}
+
+	return pool
+}
+
+func (p *ClientPool) ResourceCache() *ResourceCache {
+	return p.resources
+}
+
+// pooledClient guards the building and the token renewal of a pooled client,
+// so that neither holds up the clients of other credentials.
+type pooledClient struct {
+	client *OpenTelekomCloudClient
+	sync.Mutex
+}
+
+func (p *ClientPool) Get(auth config.CloudAuth) (*OpenTelekomCloudClient, error) {
+	key := getClientPoolKey(auth)
+
+	p.Lock()
+	entry, ok := p.clients[key]
+	if !ok {
+		entry = &pooledClient{}
+		p.clients[key] = entry
+	}
+	p.Unlock()
+
+	entry.Lock()
+	defer entry.Unlock()
+
+	if entry.client != nil {
+		err := entry.client.renewTokenIfExpired()
+		if err == nil {
+			return entry.client, nil
+		}
+
+		slog.Warn(fmt.Sprintf("renewing token of pooled client failed, rebuilding client: %s", err.Error()))
+		entry.client = nil
+	}
+
+	client, err := NewOpenTelekomCloudClient(auth, p.transport)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.client = client
+	return client, nil
+}
+
+func getClientPoolKey(auth config.CloudAuth) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%+v", auth)))
+	return fmt.Sprintf("%x", hash)
+}
@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"github.com/akyriako/cloudeye-exporter/config"
+	"testing"
+)
+
+func newTestConfig(accounts ...config.Account) *config.CloudConfig {
+	return &config.CloudConfig{
+		Accounts: accounts,
+		Global: config.Global{
+			RateLimits: config.RateLimits{Default: config.RateLimit{Rate: 10}},
+		},
+	}
+}
+
+func TestClientPoolReload(t *testing.T) {
+	production := config.Account{Name: "production", Auth: config.CloudAuth{ProjectName: "production", AccessKey: "ak"}}
+	staging := config.Account{Name: "staging", Auth: config.CloudAuth{ProjectName: "staging", AccessKey: "ak"}}
+
+	pool := NewClientPool(newTestConfig(production, staging))
+	for _, account := range []config.Account{production, staging} {
+		pool.clients[getClientPoolKey(account.Auth)] = &pooledClient{}
+		pool.resources.get(resourceCacheKey{Account: account.Name, Namespace: "SYS.ELB"})
+	}
+	next := *pool.transport.next.Load()
+
+	rotated := staging
+	rotated.Auth.AccessKey = "rotated"
+	reloaded := pool.Reload(newTestConfig(production, rotated))
+
+	if reloaded.transport != pool.transport || *reloaded.transport.next.Load() != next {
+		t.Error("the transport should be kept")
+	}
+	if reloaded.resources != pool.resources {
+		t.Error("the resource cache should be kept")
+	}
+	if _, ok := reloaded.clients[getClientPoolKey(production.Auth)]; !ok || len(reloaded.clients) != 1 {
+		t.Errorf("clients = %v, want only the client of the unchanged account", reloaded.clients)
+	}
+	if _, ok := reloaded.resources.entries[resourceCacheKey{Account: "staging", Namespace: "SYS.ELB"}]; ok || len(reloaded.resources.entries) != 1 {
+		t.Errorf("resources = %v, want only the resources of the unchanged account", reloaded.resources.entries)
+	}
+
+	changed := newTestConfig(production, rotated)
+	changed.Global.RateLimits.Default.Rate = 5
+	changed.Global.TagLabels.Keys = []string{"env"}
+	again := reloaded.Reload(changed)
+
+	if again.transport != pool.transport || *again.transport.next.Load() == next {
+		t.Error("the transport should be kept, with the transport behind it replaced")
+	}
+	if again.resources == pool.resources {
+		t.Error("the resource cache should be replaced")
+	}
+	if len(again.clients) != 1 {
+		t.Errorf("clients = %v, want the client of the unchanged account", again.clients)
+	}
+}
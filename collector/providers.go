@@ -0,0 +1,149 @@
+package collector
+
+import (
+	"fmt"
+	"github.com/akyriako/cloudeye-exporter/config"
+	"github.com/huaweicloud/golangsdk"
+	"github.com/huaweicloud/golangsdk/openstack/ces/v1/metrics"
+	"slices"
+	"sync"
+)
+
+// NamespaceProvider extends the metrics of a CES namespace with information
+// about the resources they originate from. Providers of the built-in
+// namespaces are registered by this package, further ones can be registered
+// with RegisterNamespaceProvider before the exporter starts serving.
+type NamespaceProvider interface {
+	// Namespace returns the CES namespace the provider serves, e.g. SYS.ELB.
+	Namespace() string
+
+	// ServiceClient returns a client of the service owning the resources of the
+	// namespace.
+	ServiceClient(client *OpenTelekomCloudClient) (*golangsdk.ServiceClient, error)
+
+	// ExtensionLabels returns the names of the labels attached to the metrics
+	// of every kind of resource, keyed by the sanitized namespace optionally
+	// followed by the kind of resource, e.g. sys_elb and sys_elb_listener.
+	ExtensionLabels() map[string][]string
+
+	// Resources discovers the resources of the namespace. When metric filters
+	// are configured for the namespace, keyed by comma separated dimension
+	// names, the filtered metrics of every resource are built as well, so that
+	// they do not have to be listed from CES.
+	Resources(client *OpenTelekomCloudClient, options ResourceOptions) (*Resources, error)
+}
+
+// TaggedNamespaceProvider is implemented by the providers whose resources
+// carry tags. Only the metrics of their namespaces get the tag labels, as the
+// tags of the resources of other namespaces are not known.
+type TaggedNamespaceProvider interface {
+	NamespaceProvider
+
+	// Tagged reports whether the provider fills Resources.Tags when asked to.
+	Tagged() bool
+}
+
+type ResourceOptions struct {
+	// Filters holds the names of the metrics to build, keyed by dimensions.
+	Filters map[string][]string
+
+	// WithTags is set when the tags of the resources are exported as labels,
+	// providers of taggable resources should then fill Resources.Tags, or fail
+	// when the tags cannot be read.
+	WithTags bool
+}
+
+type Resources struct {
+	// Info holds the values of the extension labels, keyed by resource id.
+	Info map[string][]string
+
+	// Tags holds the tags of the resources, keyed by resource id.
+	Tags map[string]map[string]string
+
+	// FilterMetrics holds the metrics to be queried, when filters are given.
+	FilterMetrics []metrics.Metric
+}
+
+func newResources() *Resources {
+	return &Resources{
+		Info:          make(map[string][]string),
+		Tags:          make(map[string]map[string]string),
+		FilterMetrics: make([]metrics.Metric, 0),
+	}
+}
+
+var (
+	providers       = make(map[string]NamespaceProvider)
+	extensionLabels = make(map[string][]string)
+	providersMutex  sync.RWMutex
+)
+
+// RegisterNamespaceProvider registers a provider, replacing any provider that
+// was registered for the same namespace before.
+func RegisterNamespaceProvider(provider NamespaceProvider) {
+	providersMutex.Lock()
+	defer providersMutex.Unlock()
+
+	providers[provider.Namespace()] = provider
+	for key, labels := range provider.ExtensionLabels() {
+		extensionLabels[key] = labels
+	}
+}
+
+func GetNamespaceProvider(namespace string) (NamespaceProvider, bool) {
+	providersMutex.RLock()
+	defer providersMutex.RUnlock()
+
+	provider, ok := providers[namespace]
+	return provider, ok
+}
+
+// GetNamespaces returns the namespaces with a registered provider, sorted.
+func GetNamespaces() []string {
+	providersMutex.RLock()
+	defer providersMutex.RUnlock()
+
+	namespaces := make([]string, 0, len(providers))
+	for namespace := range providers {
+		namespaces = append(namespaces, namespace)
+	}
+	slices.Sort(namespaces)
+
+	return namespaces
+}
+
+// providesTags reports whether the provider of a namespace reads the tags of
+// its resources.
+func providesTags(namespace string) bool {
+	provider, ok := GetNamespaceProvider(namespace)
+	if !ok {
+		return false
+	}
+
+	tagged, ok := provider.(TaggedNamespaceProvider)
+	return ok && tagged.Tagged()
+}
+
+// CheckTagLabels checks that none of the tag labels collides with the
+// extension labels of a registered provider.
+func CheckTagLabels(tagLabels config.TagLabels) error {
+	providersMutex.RLock()
+	defer providersMutex.RUnlock()
+
+	for _, name := range tagLabels.LabelNames() {
+		for key, labels := range extensionLabels {
+			if slices.Contains(labels, name) {
+				return fmt.Errorf("%w: tag label %s collides with an extension label of %s", config.ErrInvalid, name, key)
+			}
+		}
+	}
+
+	return nil
+}
+
+func getExtensionLabelNames(key string) []string {
+	providersMutex.RLock()
+	defer providersMutex.RUnlock()
+
+	return extensionLabels[key]
+}
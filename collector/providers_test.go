@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"errors"
+	"github.com/akyriako/cloudeye-exporter/config"
+	"github.com/huaweicloud/golangsdk"
+	"slices"
+	"testing"
+)
+
+type testProvider struct {
+	serviceClient *golangsdk.ServiceClient
+}
+
+func (p *testProvider) Namespace() string {
+	return "CUSTOM_NS.test"
+}
+
+func (p *testProvider) ServiceClient(client *OpenTelekomCloudClient) (*golangsdk.ServiceClient, error) {
+	return p.serviceClient, nil
+}
+
+func (p *testProvider) ExtensionLabels() map[string][]string {
+	return map[string][]string{
+		"custom_ns_test": {"name", "zone"},
+	}
+}
+
+func (p *testProvider) Resources(client *OpenTelekomCloudClient, options ResourceOptions) (*Resources, error) {
+	return newResources(), nil
+}
+
+func TestRegisterNamespaceProvider(t *testing.T) {
+	provider := &testProvider{serviceClient: &golangsdk.ServiceClient{}}
+	RegisterNamespaceProvider(provider)
+
+	if got, ok := GetNamespaceProvider("CUSTOM_NS.test"); !ok || got != provider {
+		t.Errorf("GetNamespaceProvider() = %v, %v, want the registered provider", got, ok)
+	}
+	if _, ok := GetNamespaceProvider("CUSTOM_NS.unknown"); ok {
+		t.Error("GetNamespaceProvider() found a provider of an unregistered namespace")
+	}
+
+	namespaces := GetNamespaces()
+	if !slices.Contains(namespaces, "CUSTOM_NS.test") || !slices.Contains(namespaces, "SYS.ELB") || !slices.IsSorted(namespaces) {
+		t.Errorf("GetNamespaces() = %v, want the sorted namespaces of all providers", namespaces)
+	}
+	if got := getExtensionLabelNames("custom_ns_test"); !slices.Equal(got, []string{"name", "zone"}) {
+		t.Errorf("getExtensionLabelNames() = %v, want the labels of the provider", got)
+	}
+
+	client, err := (&OpenTelekomCloudClient{}).GetServiceEndpoint("CUSTOM_NS.test")
+	if err != nil || client != provider.serviceClient {
+		t.Errorf("GetServiceEndpoint() = %v, %v, want the client of the provider", client, err)
+	}
+	if _, err := (&OpenTelekomCloudClient{}).GetServiceEndpoint("CUSTOM_NS.unknown"); err == nil {
+		t.Error("GetServiceEndpoint() of an unregistered namespace succeeded")
+	}
+}
+
+func TestProvidesTags(t *testing.T) {
+	tests := []struct {
+		namespace string
+		want      bool
+	}{
+		{namespace: "SYS.ECS", want: true},
+		{namespace: "SYS.RDS", want: true},
+		{namespace: "SYS.ELB", want: true},
+		{namespace: "SYS.DCS", want: true},
+		{namespace: "SYS.NAT"},
+		{namespace: "SYS.VPC"},
+		{namespace: "SYS.OBS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			if got := providesTags(tt.namespace); got != tt.want {
+				t.Errorf("providesTags(%q) = %v, want %v", tt.namespace, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTagLabels(t *testing.T) {
+	empty := ""
+
+	tests := []struct {
+		name    string
+		keys    []string
+		prefix  *string
+		wantErr bool
+	}{
+		{name: "prefixed", keys: []string{"name"}},
+		{name: "unprefixed", keys: []string{"team"}, prefix: &empty},
+		{name: "extension label", keys: []string{"name"}, prefix: &empty, wantErr: true},
+		{name: "extension label in other case", keys: []string{"VIP-Address"}, prefix: &empty, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckTagLabels(config.TagLabels{Keys: tt.keys, Prefix: tt.prefix})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckTagLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, config.ErrInvalid) {
+				t.Errorf("CheckTagLabels() error = %v, want %v", err, config.ErrInvalid)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"github.com/akyriako/cloudeye-exporter/config"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// tokenBucket allows rate requests per second on average, with bursts of up
+// to burst requests.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	sync.Mutex
+}
+
+func newTokenBucket(limit config.RateLimit) *tokenBucket {
+	burst := float64(limit.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(limit.Rate))
+	}
+
+	return &tokenBucket{
+		rate:   limit.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// reserve takes a token and returns how long the caller has to wait until the
+// token is actually available.
+func (b *tokenBucket) reserve() time.Duration {
+	b.Lock()
+	defer b.Unlock()
+
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+
+	if b.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel gives back a reserved token that was not used.
+func (b *tokenBucket) cancel() {
+	b.Lock()
+	defer b.Unlock()
+
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
+
+// rateLimiters holds a token bucket per service, services without a limit of
+// their own share the bucket of the default limit.
+type rateLimiters struct {
+	limits   config.RateLimits
+	fallback *tokenBucket
+	buckets  map[string]*tokenBucket
+	sync.Mutex
+}
+
+func newRateLimiters(limits config.RateLimits) *rateLimiters {
+	r := &rateLimiters{
+		limits:  limits,
+		buckets: make(map[string]*tokenBucket),
+	}
+
+	if limits.Default.Rate > 0 {
+		r.fallback = newTokenBucket(limits.Default)
+	}
+
+	return r
+}
+
+// get returns the bucket of a service, or nil if the service is not limited.
+func (r *rateLimiters) get(service string) *tokenBucket {
+	limit, ok := r.limits.Services[service]
+	if !ok {
+		return r.fallback
+	}
+
+	if limit.Rate <= 0 {
+		return nil
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	bucket, ok := r.buckets[service]
+	if !ok {
+		bucket = newTokenBucket(limit)
+		r.buckets[service] = bucket
+	}
+
+	return bucket
+}
+
+// rateLimitedTransport holds back requests until the rate limit of their
+// service allows them to be sent.
+type rateLimitedTransport struct {
+	next     http.RoundTripper
+	limiters *rateLimiters
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	service := getService(req)
+	bucket := t.limiters.get(service)
+	if bucket == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	wait := bucket.reserve()
+	rateLimiterWait.WithLabelValues(service).Observe(wait.Seconds())
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			bucket.cancel()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"github.com/akyriako/cloudeye-exporter/config"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	bucket := newTokenBucket(config.RateLimit{Rate: 10, Burst: 3})
+
+	for i := 0; i < 3; i++ {
+		if wait := bucket.reserve(); wait != 0 {
+			t.Fatalf("reserve() #%d = %s, want no wait within the burst", i+1, wait)
+		}
+	}
+
+	// the fourth and fifth token are due 100ms and 200ms later at 10/s
+	if wait := bucket.reserve(); wait <= 90*time.Millisecond || wait > 100*time.Millisecond {
+		t.Errorf("reserve() = %s, want about 100ms", wait)
+	}
+	if wait := bucket.reserve(); wait <= 190*time.Millisecond || wait > 200*time.Millisecond {
+		t.Errorf("reserve() = %s, want about 200ms", wait)
+	}
+
+	bucket.cancel()
+	bucket.cancel()
+	if wait := bucket.reserve(); wait <= 90*time.Millisecond || wait > 100*time.Millisecond {
+		t.Errorf("reserve() = %s, want about 100ms once the tokens were given back", wait)
+	}
+}
+
+func TestTokenBucketDefaultBurst(t *testing.T) {
+	tests := []struct {
+		limit config.RateLimit
+		want  float64
+	}{
+		{limit: config.RateLimit{Rate: 5}, want: 5},
+		{limit: config.RateLimit{Rate: 2.5}, want: 3},
+		{limit: config.RateLimit{Rate: 0.5}, want: 1},
+		{limit: config.RateLimit{Rate: 5, Burst: 20}, want: 20},
+	}
+
+	for _, tt := range tests {
+		if got := newTokenBucket(tt.limit).burst; got != tt.want {
+			t.Errorf("newTokenBucket(%+v).burst = %v, want %v", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiters(t *testing.T) {
+	limiters := newRateLimiters(config.RateLimits{
+		Default: config.RateLimit{Rate: 10},
+		Services: map[string]config.RateLimit{
+			"CES": {Rate: 5},
+			"IAM": {Rate: 0},
+		},
+	})
+
+	if limiters.get("CES") == nil || limiters.get("CES") != limiters.get("CES") {
+		t.Error("get(CES) should return the same bucket of its own")
+	}
+	if limiters.get("CES") == limiters.get("ELB") {
+		t.Error("get(CES) should not share the default bucket")
+	}
+	if limiters.get("ELB") != limiters.fallback || limiters.get("RDS") != limiters.fallback {
+		t.Error("services without a limit of their own should share the default bucket")
+	}
+	if limiters.get("IAM") != nil {
+		t.Error("get(IAM) should return no bucket for a zero rate")
+	}
+
+	unlimited := newRateLimiters(config.RateLimits{})
+	if unlimited.get("ELB") != nil {
+		t.Error("get(ELB) should return no bucket without a default rate")
+	}
+}
+
+func TestRateLimitedTransportCancelled(t *testing.T) {
+	sent := 0
+	transport := &rateLimitedTransport{
+		limiters: newRateLimiters(config.RateLimits{Default: config.RateLimit{Rate: 1, Burst: 1}}),
+		next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			sent++
+			return newResponse(http.StatusOK, nil), nil
+		}),
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://ces.example.com/V1.0/metrics", nil)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := transport.RoundTrip(req.WithContext(ctx))
+	if !errors.Is(err, context.DeadlineExceeded) || sent != 1 {
+		t.Errorf("RoundTrip() error = %v after %d sent, want %v after 1", err, sent, context.DeadlineExceeded)
+	}
+
+	bucket := transport.limiters.get("CES")
+	if bucket.tokens < -0.1 {
+		t.Errorf("tokens = %v, want the token of the cancelled request given back", bucket.tokens)
+	}
+}
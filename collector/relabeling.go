@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/huaweicloud/golangsdk/openstack/ces/v1/metricdata"
+	"slices"
 	"strings"
 )
 
@@ -36,6 +37,10 @@ var (
 		"postgresql_instance_id":    "instance",
 		"rds_instance_sqlserver_id": "instance",
 	}
+
+	// reservedLabels are the labels the exporter attaches itself, dimensions
+	// of the same name are exported prefixed with dimension_ instead.
+	reservedLabels = []string{"account", "project", "region", "aggregation"}
 )
 
 func sanitazeNamespace(namespace string) string {
@@ -49,11 +54,15 @@ func getMetricPrefixName(prefix string, namespace string) string {
 	return fmt.Sprintf("%s_%s", prefix, sanitazeNamespace(namespace))
 }
 
-func relabelMetricData(allResourcesInfo map[string][]string, metric metricdata.MetricData) (*LabelInfo, error) {
+// relabelMetricData returns the labels of a metric, the extension labels of its
+// resource, followed by the labels of its tags, are only attached when
+// withExtensionLabels is set.
+func relabelMetricData(allResourcesInfo map[string][]string, metric metricData, withExtensionLabels bool, tagLabels []string) (*LabelInfo, error) {
 	labels, values, preResourceName, privateFlag := getOriginalLabelInfo(&metric.Dimensions)
 
-	if isInTheResourceList(&metric.Dimensions, &allResourcesInfo) {
+	if withExtensionLabels && isInTheResourceList(&metric.Dimensions, &allResourcesInfo) {
 		labels = getExtensionLabels(labels, preResourceName, metric.Namespace, privateFlag)
+		labels = append(labels, tagLabels...)
 		values = getExtensionLabelValues(values, &allResourcesInfo, getOriginalID(&metric.Dimensions))
 	}
 
@@ -75,12 +84,12 @@ func isInTheResourceList(dims *[]metricdata.Dimension, allResourceInfo *map[stri
 	return false
 }
 
-func getLatestData(data []metricdata.Data) (float64, error) {
+func getLatestData(data []datapoint, filter string) (float64, error) {
 	if len(data) == 0 {
 		return 0, errors.New("data not found")
 	}
 
-	return data[len(data)-1].Average, nil
+	return data[len(data)-1].valueOf(filter)
 }
 
 func getOriginalID(dimensions *[]metricdata.Dimension) string {
@@ -110,11 +119,11 @@ func getOriginalLabelInfo(dims *[]metricdata.Dimension) ([]string, []string, str
 		}
 
 		dimensionValues = append(dimensionValues, dimension.Value)
-		if strings.ContainsAny(dimension.Name, "-") {
-			labels = append(labels, strings.Replace(dimension.Name, "-", "_", -1))
-			continue
+		label := strings.Replace(dimension.Name, "-", "_", -1)
+		if slices.Contains(reservedLabels, label) {
+			label = "dimension_" + label
 		}
-		labels = append(labels, dimension.Name)
+		labels = append(labels, label)
 	}
 
 	return labels, dimensionValues, preResourceName, privateFlag
@@ -123,6 +132,12 @@ func getOriginalLabelInfo(dims *[]metricdata.Dimension) ([]string, []string, str
 func getExtensionLabels(
 	labels []string, preResourceName string, namespace string, privateFlag string) []string {
 
+	newlabels := append(labels, getExtensionLabelNames(getExtensionKey(namespace, preResourceName, privateFlag))...)
+
+	return newlabels
+}
+
+func getExtensionKey(namespace string, preResourceName string, privateFlag string) string {
 	namespace = sanitazeNamespace(namespace)
 	if preResourceName != "" {
 		namespace = namespace + "_" + preResourceName
@@ -132,9 +147,7 @@ func getExtensionLabels(
 		namespace = namespace + "_" + privateFlag
 	}
 
-	newlabels := append(labels, defaultExtensionLabels[namespace]...)
-
-	return newlabels
+	return namespace
 }
 
 func getExtensionLabelValues(
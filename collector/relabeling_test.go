@@ -0,0 +1,43 @@
+package collector
+
+import (
+	"github.com/huaweicloud/golangsdk/openstack/ces/v1/metricdata"
+	"slices"
+	"testing"
+)
+
+func TestGetOriginalLabelInfo(t *testing.T) {
+	tests := []struct {
+		name       string
+		dimensions []metricdata.Dimension
+		wantLabels []string
+	}{
+		{
+			name:       "plain",
+			dimensions: []metricdata.Dimension{{Name: "lbaas_instance_id", Value: "1"}},
+			wantLabels: []string{"lbaas_instance_id"},
+		},
+		{
+			name:       "dash",
+			dimensions: []metricdata.Dimension{{Name: "instance-id", Value: "1"}},
+			wantLabels: []string{"instance_id"},
+		},
+		{
+			name:       "reserved",
+			dimensions: []metricdata.Dimension{{Name: "region", Value: "eu-de"}, {Name: "project", Value: "p"}},
+			wantLabels: []string{"dimension_region", "dimension_project"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels, values, _, _ := getOriginalLabelInfo(&tt.dimensions)
+			if !slices.Equal(labels, tt.wantLabels) {
+				t.Errorf("labels = %v, want %v", labels, tt.wantLabels)
+			}
+			if len(values) != len(tt.dimensions) {
+				t.Errorf("values = %v, want one per dimension", values)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/akyriako/cloudeye-exporter/config"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var retryableStatusCodes = map[int]struct{}{
+	http.StatusTooManyRequests:     {},
+	http.StatusInternalServerError: {},
+	http.StatusBadGateway:          {},
+	http.StatusServiceUnavailable:  {},
+	http.StatusGatewayTimeout:      {},
+}
+
+// retryTransport retries requests that failed in transit or were answered
+// with a throttling or server error status code, with an exponential backoff
+// and full jitter between the attempts. A Retry-After header of a response
+// takes precedence over the backoff.
+type retryTransport struct {
+	next   http.RoundTripper
+	policy config.Retry
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		attemptReq, err := rewindRequest(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.next.RoundTrip(attemptReq)
+		if attempt >= t.policy.GetMaxRetries() || !isRetryable(req, resp, err) {
+			return resp, err
+		}
+
+		wait := t.backoff(attempt, resp)
+		if err != nil {
+			slog.Debug(fmt.Sprintf("retrying %s %s in %s, attempt %d failed: %s", req.Method, req.URL.Path, wait, attempt+1, err.Error()))
+		} else {
+			slog.Debug(fmt.Sprintf("retrying %s %s in %s, attempt %d got status code %d", req.Method, req.URL.Path, wait, attempt+1, resp.StatusCode))
+			// the response is discarded, the connection can be reused once the body is drained
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the time to wait before the next attempt, either as
+// requested by the Retry-After header of the response or a random duration up
+// to an exponentially growing limit.
+func (t *retryTransport) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return min(wait, t.policy.MaxBackoff)
+		}
+	}
+
+	limit := t.policy.InitialBackoff << attempt
+	if limit <= 0 || limit > t.policy.MaxBackoff {
+		limit = t.policy.MaxBackoff
+	}
+
+	return time.Duration(rand.Int63n(int64(limit) + 1))
+}
+
+func isRetryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	_, ok := retryableStatusCodes[resp.StatusCode]
+	return ok
+}
+
+// rewindRequest returns the request to be sent for an attempt, with a fresh
+// copy of the body for every attempt after the first one.
+func rewindRequest(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 0 || req.GetBody == nil {
+		return req, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	attemptReq := req.Clone(req.Context())
+	attemptReq.Body = body
+	return attemptReq, nil
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
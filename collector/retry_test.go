@@ -0,0 +1,209 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"github.com/akyriako/cloudeye-exporter/config"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc answers requests with a function, e.g. a canned response.
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newResponse(statusCode int, header http.Header) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader("")),
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{name: "empty", value: ""},
+		{name: "seconds", value: "3", want: 3 * time.Second, wantOk: true},
+		{name: "zero", value: "0", want: 0, wantOk: true},
+		{name: "negative", value: "-1"},
+		{name: "past date", value: "Wed, 21 Oct 2015 07:28:00 GMT", want: 0, wantOk: true},
+		{name: "garbage", value: "soon"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value)
+			if ok != tt.wantOk || got != tt.want {
+				t.Errorf("parseRetryAfter(%q) = %s, %v, want %s, %v", tt.value, got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+
+	future := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	got, ok := parseRetryAfter(future)
+	if !ok || got <= 58*time.Second || got > time.Minute {
+		t.Errorf("parseRetryAfter(%q) = %s, %v, want about a minute", future, got, ok)
+	}
+}
+
+func TestRetryTransportBackoff(t *testing.T) {
+	transport := &retryTransport{policy: config.Retry{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+	}}
+
+	for attempt := 0; attempt < 8; attempt++ {
+		limit := min(100*time.Millisecond<<attempt, time.Second)
+		for i := 0; i < 100; i++ {
+			wait := transport.backoff(attempt, nil)
+			if wait < 0 || wait > limit {
+				t.Fatalf("backoff(%d) = %s, want at most %s", attempt, wait, limit)
+			}
+		}
+	}
+
+	resp := newResponse(http.StatusTooManyRequests, http.Header{"Retry-After": {"30"}})
+	if wait := transport.backoff(0, resp); wait != time.Second {
+		t.Errorf("backoff() = %s, want the Retry-After capped at the max backoff", wait)
+	}
+
+	resp = newResponse(http.StatusTooManyRequests, http.Header{"Retry-After": {"0"}})
+	if wait := transport.backoff(3, resp); wait != 0 {
+		t.Errorf("backoff() = %s, want the Retry-After", wait)
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		responses    []int
+		err          error
+		wantAttempts int
+		wantStatus   int
+	}{
+		{name: "success", responses: []int{200}, wantAttempts: 1, wantStatus: 200},
+		{name: "throttled once", responses: []int{429, 200}, wantAttempts: 2, wantStatus: 200},
+		{name: "server errors", responses: []int{503, 502, 500, 504}, wantAttempts: 3, wantStatus: 500},
+		{name: "client error", responses: []int{404, 200}, wantAttempts: 1, wantStatus: 404},
+		{name: "transport error", err: errors.New("connection reset"), wantAttempts: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			transport := &retryTransport{
+				policy: config.Retry{MaxRetries: retries(2), InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+				next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					attempts++
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return newResponse(tt.responses[attempts-1], nil), nil
+				}),
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, "https://ces.example.com/V1.0/metrics", nil)
+			resp, err := transport.RoundTrip(req)
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil || resp.StatusCode != tt.wantStatus {
+				t.Errorf("RoundTrip() = %v, %v, want status code %d", resp, err, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRetryTransportMaxRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxRetries   *int
+		wantAttempts int
+	}{
+		{name: "default", wantAttempts: 4},
+		{name: "disabled", maxRetries: retries(0), wantAttempts: 1},
+		{name: "once", maxRetries: retries(1), wantAttempts: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			transport := &retryTransport{
+				policy: config.Retry{MaxRetries: tt.maxRetries, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+				next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+					attempts++
+					return newResponse(http.StatusServiceUnavailable, nil), nil
+				}),
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, "https://ces.example.com/V1.0/metrics", nil)
+			_, _ = transport.RoundTrip(req)
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryTransportRewindsBody(t *testing.T) {
+	bodies := make([]string, 0)
+	transport := &retryTransport{
+		policy: config.Retry{MaxRetries: retries(1), InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			body, _ := io.ReadAll(req.Body)
+			bodies = append(bodies, string(body))
+			return newResponse(http.StatusServiceUnavailable, nil), nil
+		}),
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "https://ces.example.com/V1.0/batch-query-metric-data", strings.NewReader("query"))
+	_, _ = transport.RoundTrip(req)
+	if len(bodies) != 2 || bodies[0] != "query" || bodies[1] != "query" {
+		t.Errorf("bodies = %q, want the body sent twice", bodies)
+	}
+}
+
+func TestRetryTransportCancelled(t *testing.T) {
+	attempts := 0
+	transport := &retryTransport{
+		policy: config.Retry{MaxRetries: retries(3), InitialBackoff: time.Hour, MaxBackoff: time.Hour},
+		next: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			return newResponse(http.StatusTooManyRequests, http.Header{"Retry-After": {"60"}}), nil
+		}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://ces.example.com/V1.0/metrics", nil)
+	_, err := transport.RoundTrip(req)
+	if !errors.Is(err, context.DeadlineExceeded) || attempts != 1 {
+		t.Errorf("RoundTrip() error = %v after %d attempts, want %v after 1", err, attempts, context.DeadlineExceeded)
+	}
+}
+
+func retries(n int) *int {
+	return &n
+}
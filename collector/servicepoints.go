@@ -16,6 +16,7 @@ func (c *OpenTelekomCloudClient) GetCESClient() (*golangsdk.ServiceClient, error
 		return nil, err
 	}
 
+	c.endpoints.register(client, "CES")
 	return client, nil
 }
 
@@ -28,6 +29,7 @@ func (c *OpenTelekomCloudClient) GetELBClient() (*golangsdk.ServiceClient, error
 		return nil, err
 	}
 
+	c.endpoints.register(client, "ELB")
 	return client, nil
 }
 
@@ -40,6 +42,7 @@ func (c *OpenTelekomCloudClient) GetNATClient() (*golangsdk.ServiceClient, error
 		return nil, err
 	}
 
+	c.endpoints.register(client, "NAT")
 	return client, nil
 }
 
@@ -52,6 +55,7 @@ func (c *OpenTelekomCloudClient) GetRDSClient() (*golangsdk.ServiceClient, error
 		return nil, err
 	}
 
+	c.endpoints.register(client, "RDS")
 	return client, nil
 }
 
@@ -64,6 +68,7 @@ func (c *OpenTelekomCloudClient) GetDCSClient() (*golangsdk.ServiceClient, error
 		return nil, err
 	}
 
+	c.endpoints.register(client, "DCS")
 	return client, nil
 }
 
@@ -76,6 +81,7 @@ func (c *OpenTelekomCloudClient) GetDMSClient() (*golangsdk.ServiceClient, error
 		return nil, err
 	}
 
+	c.endpoints.register(client, "DMS")
 	return client, nil
 }
 
@@ -88,6 +94,7 @@ func (c *OpenTelekomCloudClient) GetVPCClient() (*golangsdk.ServiceClient, error
 		return nil, err
 	}
 
+	c.endpoints.register(client, "VPC")
 	return client, nil
 }
 
@@ -100,6 +107,7 @@ func (c *OpenTelekomCloudClient) GetEVSClient() (*golangsdk.ServiceClient, error
 		return nil, err
 	}
 
+	c.endpoints.register(client, "EVS")
 	return client, nil
 }
 
@@ -112,6 +120,22 @@ func (c *OpenTelekomCloudClient) GetECSClient() (*golangsdk.ServiceClient, error
 		return nil, err
 	}
 
+	c.endpoints.register(client, "ECS")
+	return client, nil
+}
+
+// GetECSV1Client returns a client of the native ECS API, which unlike the
+// compute API manages the tags of the servers.
+func (c *OpenTelekomCloudClient) GetECSV1Client() (*golangsdk.ServiceClient, error) {
+	client, err := openstack.NewEcsV1(c.HwClient, golangsdk.EndpointOpts{
+		Region: c.Config.Region,
+	})
+	if err != nil {
+		slog.Error(fmt.Sprintf("acquiring an ECS v1 client failed: %s", err.Error()))
+		return nil, err
+	}
+
+	c.endpoints.register(client, "ECS")
 	return client, nil
 }
 
@@ -124,6 +148,7 @@ func (c *OpenTelekomCloudClient) GetASClient() (*golangsdk.ServiceClient, error)
 		return nil, err
 	}
 
+	c.endpoints.register(client, "AS")
 	return client, nil
 }
 
@@ -136,5 +161,6 @@ func (c *OpenTelekomCloudClient) GetFGSClient() (*golangsdk.ServiceClient, error
 		return nil, err
 	}
 
+	c.endpoints.register(client, "FGS")
 	return client, nil
 }
@@ -0,0 +1,111 @@
+package collector
+
+import (
+	"context"
+	"github.com/akyriako/cloudeye-exporter/config"
+	"github.com/huaweicloud/golangsdk"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type serviceContextKey struct{}
+
+// NewTransport builds the transport shared by all the clients of a pool, every
+// request sent to the Open Telekom Cloud APIs is retried according to the
+// retry policy, every attempt is held back by the rate limit of its service
+// and instrumented.
+func NewTransport(global config.Global) http.RoundTripper {
+	return &retryTransport{
+		policy: global.Retry,
+		next: &rateLimitedTransport{
+			limiters: newRateLimiters(global.RateLimits),
+			next: &instrumentedTransport{
+				next: http.DefaultTransport,
+			},
+		},
+	}
+}
+
+// reloadableTransport lets the pooled clients keep their transport across
+// reloads, while the transport it hands the requests to is replaced whenever
+// the retry policy or the rate limits change.
+type reloadableTransport struct {
+	next atomic.Pointer[http.RoundTripper]
+}
+
+func newReloadableTransport(next http.RoundTripper) *reloadableTransport {
+	t := &reloadableTransport{}
+	t.replace(next)
+	return t
+}
+
+func (t *reloadableTransport) replace(next http.RoundTripper) {
+	t.next.Store(&next)
+}
+
+func (t *reloadableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return (*t.next.Load()).RoundTrip(req)
+}
+
+// serviceEndpoints maps the base urls of the service clients to the name of
+// their service, so that outgoing requests can be attributed to a service.
+type serviceEndpoints struct {
+	endpoints map[string]string
+	sync.RWMutex
+}
+
+func newServiceEndpoints() *serviceEndpoints {
+	return &serviceEndpoints{
+		endpoints: make(map[string]string),
+	}
+}
+
+func (s *serviceEndpoints) register(client *golangsdk.ServiceClient, service string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.endpoints[client.ResourceBaseURL()] = service
+}
+
+// lookup returns the service of the longest registered base url the request
+// url starts with, or the first label of the host, e.g. IAM, otherwise.
+func (s *serviceEndpoints) lookup(req *http.Request) string {
+	s.RLock()
+	defer s.RUnlock()
+
+	url := req.URL.String()
+	service, longest := "", 0
+	for endpoint, name := range s.endpoints {
+		if len(endpoint) > longest && strings.HasPrefix(url, endpoint) {
+			service, longest = name, len(endpoint)
+		}
+	}
+
+	if service == "" {
+		service = strings.ToUpper(strings.Split(req.URL.Hostname(), ".")[0])
+	}
+
+	return service
+}
+
+// serviceTransport attaches the service a request is addressed to in its
+// context, for the transports down the chain.
+type serviceTransport struct {
+	next      http.RoundTripper
+	endpoints *serviceEndpoints
+}
+
+func (t *serviceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := context.WithValue(req.Context(), serviceContextKey{}, t.endpoints.lookup(req))
+	return t.next.RoundTrip(req.WithContext(ctx))
+}
+
+func getService(req *http.Request) string {
+	if service, ok := req.Context().Value(serviceContextKey{}).(string); ok {
+		return service
+	}
+
+	return strings.ToUpper(strings.Split(req.URL.Hostname(), ".")[0])
+}
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// envReference matches ${VAR}, and $${VAR} which escapes it.
+var envReference = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces every ${VAR} in the string fields of the decoded
+// configuration with the value of the environment variable VAR, referencing an
+// unset variable is an error. $${VAR} is kept as the literal ${VAR}. Values are
+// expanded after parsing, so that they are never interpreted as YAML.
+func expandEnv(value reflect.Value) error {
+	switch value.Kind() {
+	case reflect.Pointer:
+		if value.IsNil() {
+			return nil
+		}
+		return expandEnv(value.Elem())
+	case reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			if !value.Field(i).CanSet() {
+				continue
+			}
+			err := expandEnv(value.Field(i))
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			err := expandEnv(value.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		iter := value.MapRange()
+		for iter.Next() {
+			// map elements are not addressable, they are expanded in a copy
+			element := reflect.New(iter.Value().Type()).Elem()
+			element.Set(iter.Value())
+			err := expandEnv(element)
+			if err != nil {
+				return err
+			}
+			value.SetMapIndex(iter.Key(), element)
+		}
+	case reflect.String:
+		expanded, err := expandEnvString(value.String())
+		if err != nil {
+			return err
+		}
+		value.SetString(expanded)
+	}
+
+	return nil
+}
+
+func expandEnvString(s string) (string, error) {
+	var err error
+	expanded := envReference.ReplaceAllStringFunc(s, func(reference string) string {
+		if strings.HasPrefix(reference, "$$") {
+			return reference[1:]
+		}
+
+		name := envReference.FindStringSubmatch(reference)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable %s referenced in config is not set", name)
+		}
+		return value
+	})
+
+	return expanded, err
+}
+
+// credentialFiles returns the credential fields of an auth block paired with
+// their *_file variants.
+func (a *CloudAuth) credentialFiles() map[string]struct {
+	value *string
+	file  string
+} {
+	return map[string]struct {
+		value *string
+		file  string
+	}{
+		"access_key": {&a.AccessKey, a.AccessKeyFile},
+		"secret_key": {&a.SecretKey, a.SecretKeyFile},
+		"password":   {&a.Password, a.PasswordFile},
+	}
+}
+
+// readCredentialFiles sets the credentials given as *_file from the content of
+// their files, without trailing whitespace.
+func (a *CloudAuth) readCredentialFiles() error {
+	for name, credential := range a.credentialFiles() {
+		if credential.file == "" {
+			continue
+		}
+		if *credential.value != "" {
+			return fmt.Errorf("%w: only one of %s and %s_file may be set", ErrInvalid, name, name)
+		}
+
+		data, err := os.ReadFile(credential.file)
+		if err != nil {
+			return fmt.Errorf("reading %s_file failed: %w", name, err)
+		}
+		*credential.value = strings.TrimRight(string(data), " \t\r\n")
+	}
+
+	return nil
+}
+
+// envFallbacks are the environment variables, in order of precedence, that
+// provide the fields omitted in the auth block.
+func (a *CloudAuth) envFallbacks() map[*string][]string {
+	return map[*string][]string{
+		&a.AuthURL:     {"OS_AUTH_URL", "OTC_AUTH_URL"},
+		&a.Region:      {"OS_REGION_NAME", "OTC_REGION_NAME"},
+		&a.ProjectName: {"OS_PROJECT_NAME", "OS_TENANT_NAME", "OTC_PROJECT_NAME"},
+		&a.ProjectID:   {"OS_PROJECT_ID", "OS_TENANT_ID", "OTC_PROJECT_ID"},
+		&a.DomainName:  {"OS_USER_DOMAIN_NAME", "OS_DOMAIN_NAME", "OTC_DOMAIN_NAME"},
+		&a.DomainID:    {"OS_USER_DOMAIN_ID", "OS_DOMAIN_ID", "OTC_DOMAIN_ID"},
+		&a.UserName:    {"OS_USERNAME", "OTC_USERNAME"},
+		&a.UserID:      {"OS_USER_ID", "OTC_USER_ID"},
+		&a.Password:    {"OS_PASSWORD", "OTC_PASSWORD"},
+		&a.AccessKey:   {"OS_ACCESS_KEY", "OTC_ACCESS_KEY"},
+		&a.SecretKey:   {"OS_SECRET_KEY", "OTC_SECRET_KEY"},
+	}
+}
+
+func (a *CloudAuth) applyEnvFallbacks() {
+	identified := a.identified()
+	for field, names := range a.envFallbacks() {
+		if *field != "" || identified[field] {
+			continue
+		}
+		for _, name := range names {
+			if value := os.Getenv(name); value != "" {
+				*field = value
+				break
+			}
+		}
+	}
+}
+
+// identityPairs returns the name and id fields of the project, the domain and
+// the user, of which validate accepts only one.
+func (a *CloudAuth) identityPairs() map[string][2]*string {
+	return map[string][2]*string{
+		"project": {&a.ProjectName, &a.ProjectID},
+		"domain":  {&a.DomainName, &a.DomainID},
+		"user":    {&a.UserName, &a.UserID},
+	}
+}
+
+// identified returns the name and id fields whose project, domain or user is
+// already given by either of them, so that falling back on other sources does
+// not pair a name with the id of possibly another project, domain or user.
+func (a *CloudAuth) identified() map[*string]bool {
+	identified := make(map[*string]bool)
+	for _, pair := range a.identityPairs() {
+		if *pair[0] != "" || *pair[1] != "" {
+			identified[pair[0]] = true
+			identified[pair[1]] = true
+		}
+	}
+
+	return identified
+}
+
+// resolveAuth reads the credential files of every auth block. The environment
+// fallbacks only apply to the single auth block, when no accounts are given.
+func resolveAuth(config *CloudConfig) error {
+	err := config.Auth.readCredentialFiles()
+	if err != nil {
+		return fmt.Errorf("auth: %w", err)
+	}
+
+	for i := range config.Accounts {
+		err := config.Accounts[i].Auth.readCredentialFiles()
+		if err != nil {
+			return fmt.Errorf("account %s: %w", config.Accounts[i].Name, err)
+		}
+	}
+
+	if len(config.Accounts) == 0 {
+		config.Auth.applyEnvFallbacks()
+	}
+
+	return nil
+}
+
+// CredentialFiles returns the paths of the credential files of all accounts,
+// and of the secure.yaml the clouds were merged with.
+func (c *CloudConfig) CredentialFiles() []string {
+	paths := make([]string, 0)
+	if c.secureFile != "" {
+		paths = append(paths, c.secureFile)
+	}
+	for i := range c.Accounts {
+		for _, credential := range c.Accounts[i].Auth.credentialFiles() {
+			if credential.file != "" {
+				paths = append(paths, credential.file)
+			}
+		}
+	}
+
+	return paths
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestExpandEnvString(t *testing.T) {
+	t.Setenv("EXPORTER_TEST_VALUE", "abc #123")
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain", value: "abc", want: "abc"},
+		{name: "reference", value: "${EXPORTER_TEST_VALUE}", want: "abc #123"},
+		{name: "embedded reference", value: "x-${EXPORTER_TEST_VALUE}-y", want: "x-abc #123-y"},
+		{name: "escaped reference", value: "$${EXPORTER_TEST_VALUE}", want: "${EXPORTER_TEST_VALUE}"},
+		{name: "not a reference", value: "a$b${", want: "a$b${"},
+		{name: "unset variable", value: "${EXPORTER_TEST_UNSET}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandEnvString(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandEnvString(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Errorf("expandEnvString(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetConfigFromFileExpandsEnv(t *testing.T) {
+	t.Setenv("EXPORTER_TEST_PASSWORD", "abc #123: \"x\"\nkey: value")
+
+	dir := t.TempDir()
+	path := writeFile(t, dir, "clouds.yaml", `
+auth:
+  auth_url: https://iam.example.com/v3
+  project_name: project
+  domain_name: domain
+  user_name: user
+  # secret_key: ${EXPORTER_TEST_UNSET}
+  password: ${EXPORTER_TEST_PASSWORD}
+  region: $${region}
+`)
+
+	config, err := GetConfigFromFile(path, false, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth := config.Accounts[0].Auth
+	if auth.Password != "abc #123: \"x\"\nkey: value" {
+		t.Errorf("password = %q", auth.Password)
+	}
+	if auth.Region != "${region}" {
+		t.Errorf("region = %q, want the escaped reference", auth.Region)
+	}
+}
+
+func TestGetConfigFromFileUnsetEnv(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "clouds.yaml", `
+auth:
+  auth_url: https://iam.example.com/v3
+  project_name: project
+  access_key: ${EXPORTER_TEST_UNSET}
+  secret_key: sk
+  region: eu-de
+`)
+
+	_, err := GetConfigFromFile(path, false, "", "")
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("error = %v, want %v", err, ErrInvalid)
+	}
+}
+
+func TestReadCredentialFiles(t *testing.T) {
+	dir := t.TempDir()
+	secretKeyFile := writeFile(t, dir, "sk", "secret\n")
+
+	tests := []struct {
+		name    string
+		auth    CloudAuth
+		want    string
+		wantErr bool
+	}{
+		{name: "file", auth: CloudAuth{SecretKeyFile: secretKeyFile}, want: "secret"},
+		{name: "value", auth: CloudAuth{SecretKey: "value"}, want: "value"},
+		{name: "both", auth: CloudAuth{SecretKey: "value", SecretKeyFile: secretKeyFile}, wantErr: true},
+		{name: "missing file", auth: CloudAuth{SecretKeyFile: filepath.Join(dir, "missing")}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.auth.readCredentialFiles()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readCredentialFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && tt.auth.SecretKey != tt.want {
+				t.Errorf("secret key = %q, want %q", tt.auth.SecretKey, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEnvFallbacks(t *testing.T) {
+	t.Setenv("OS_AUTH_URL", "https://os.example.com/v3")
+	t.Setenv("OTC_AUTH_URL", "https://otc.example.com/v3")
+	t.Setenv("OTC_REGION_NAME", "eu-nl")
+	t.Setenv("OS_PROJECT_NAME", "project")
+	t.Setenv("OS_PROJECT_ID", "project-id")
+
+	auth := CloudAuth{Region: "eu-de", ProjectID: "configured"}
+	auth.applyEnvFallbacks()
+
+	if auth.AuthURL != "https://os.example.com/v3" {
+		t.Errorf("auth url = %q, want the OS_ variable to take precedence", auth.AuthURL)
+	}
+	if auth.Region != "eu-de" {
+		t.Errorf("region = %q, want the configured one", auth.Region)
+	}
+	if auth.ProjectID != "configured" || auth.ProjectName != "" {
+		t.Errorf("project = %q/%q, want only the configured id", auth.ProjectName, auth.ProjectID)
+	}
+}
@@ -4,51 +4,150 @@ import (
 	_ "embed"
 	"fmt"
 	"os"
+	"reflect"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
+// CloudAuth holds the credentials of a project. The access key, secret key and
+// password can be read from files given by their *_file variants instead. The
+// project, domain and user are given either by name or by id.
 type CloudAuth struct {
-	ProjectName string `yaml:"project_name"`
-	ProjectID   string `yaml:"project_id"`
-	DomainName  string `yaml:"domain_name"`
-	AccessKey   string `yaml:"access_key"`
-	Region      string `yaml:"region"`
-	SecretKey   string `yaml:"secret_key"`
-	AuthURL     string `yaml:"auth_url"`
-	UserName    string `yaml:"user_name"`
-	Password    string `yaml:"password"`
+	ProjectName   string `yaml:"project_name"`
+	ProjectID     string `yaml:"project_id"`
+	DomainName    string `yaml:"domain_name"`
+	DomainID      string `yaml:"domain_id"`
+	AccessKey     string `yaml:"access_key"`
+	AccessKeyFile string `yaml:"access_key_file"`
+	Region        string `yaml:"region"`
+	SecretKey     string `yaml:"secret_key"`
+	SecretKeyFile string `yaml:"secret_key_file"`
+	AuthURL       string `yaml:"auth_url"`
+	UserName      string `yaml:"user_name"`
+	UserID        string `yaml:"user_id"`
+	Password      string `yaml:"password"`
+	PasswordFile  string `yaml:"password_file"`
+}
+
+// Account authenticates with its auth block, or with the cloud of that name
+// of a standard OpenStack clouds.yaml, the auth block taking precedence.
+type Account struct {
+	Name  string    `yaml:"name"`
+	Cloud string    `yaml:"cloud"`
+	Auth  CloudAuth `yaml:"auth"`
+}
+
+type PollingNamespace struct {
+	Namespace string        `yaml:"namespace"`
+	Account   string        `yaml:"account"`
+	Interval  time.Duration `yaml:"interval"`
+}
+
+type Polling struct {
+	Enabled    bool               `yaml:"enabled"`
+	Interval   time.Duration      `yaml:"interval"`
+	Namespaces []PollingNamespace `yaml:"namespaces"`
+}
+
+// Retry retries a failed request up to MaxRetries times, or
+// DefaultRetryMaxRetries times if MaxRetries is not set; zero disables the
+// retries.
+type Retry struct {
+	MaxRetries     *int          `yaml:"max_retries"`
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+}
+
+// RateLimit allows Rate requests per second on average, with bursts of up to
+// Burst requests. A zero Rate disables the limit.
+type RateLimit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// RateLimits are keyed by service, i.e. CES, ELB, NAT, RDS, DCS, DMS, VPC, EVS,
+// ECS, AS, FGS and IAM. Services without a limit of their own share Default.
+type RateLimits struct {
+	Default  RateLimit            `yaml:"default"`
+	Services map[string]RateLimit `yaml:"services"`
 }
 
 type Global struct {
-	Port            string `yaml:"port"`
-	Prefix          string `yaml:"prefix"`
-	MetricsPath     string `yaml:"metrics_path"`
-	MaxRoutines     int    `yaml:"max_routines"`
-	ScrapeBatchSize int    `yaml:"scrape_batch_size"`
+	Port            string                      `yaml:"port"`
+	Prefix          string                      `yaml:"prefix"`
+	MetricsPath     string                      `yaml:"metrics_path"`
+	InternalPath    string                      `yaml:"internal_metrics_path"`
+	MaxRoutines     int                         `yaml:"max_routines"`
+	ScrapeBatchSize int                         `yaml:"scrape_batch_size"`
+	Polling         Polling                     `yaml:"polling"`
+	Query           QueryOptions                `yaml:"query"`
+	AggregationMode string                      `yaml:"aggregation_mode"`
+	ErrorPolicy     string                      `yaml:"error_policy"`
+	LabelMode       string                      `yaml:"label_mode"`
+	TagLabels       TagLabels                   `yaml:"tag_labels"`
+	Discovery       Discovery                   `yaml:"discovery"`
+	DefaultServices []string                    `yaml:"default_services"`
+	Profiles        map[string]Profile          `yaml:"profiles"`
+	MetricFilters   string                      `yaml:"metric_filters"`
+	Retry           Retry                       `yaml:"retry"`
+	RateLimits      RateLimits                  `yaml:"rate_limits"`
+	ScrapeCacheTTL  time.Duration               `yaml:"scrape_cache_ttl"`
+	ResourceTTL     time.Duration               `yaml:"resource_ttl"`
+	Namespaces      map[string]NamespaceOptions `yaml:"namespaces"`
 }
 
 type CloudConfig struct {
-	Auth   CloudAuth `yaml:"auth"`
-	Global Global    `yaml:"global"`
+	Auth     CloudAuth                 `yaml:"auth"`
+	Accounts []Account                 `yaml:"accounts"`
+	Global   Global                    `yaml:"global"`
+	Clouds   map[string]OpenStackCloud `yaml:"clouds"`
+
+	secureFile        string
+	metricsFilters    map[string]map[string][]string
+	metricFilterRules map[string]NamespaceFilters
 }
 
 const (
 	DefaultPort            int    = 8087
 	DefaultPrefix          string = "opentelekomcloud"
 	DefaultMetricsPath     string = "/metrics"
+	DefaultInternalPath    string = "/internal/metrics"
 	DefaultMaxRoutines     int    = 20
 	DefaultScrapeBatchSize int    = 10
+
+	DefaultPollingInterval time.Duration = time.Minute
+	DefaultResourceTTL     time.Duration = time.Hour * 3
+
+	DefaultRetryMaxRetries     int           = 3
+	DefaultRetryInitialBackoff time.Duration = time.Millisecond * 500
+	DefaultRetryMaxBackoff     time.Duration = time.Second * 10
+
+	DefaultAccountName string = "default"
+
+	// ErrorPolicyPartial serves whatever could be collected when a namespace
+	// fails, ErrorPolicyFail fails the whole scrape instead.
+	ErrorPolicyPartial string = "partial"
+	ErrorPolicyFail    string = "fail"
+
+	// LabelModeLabels attaches the extension labels of a resource to every
+	// series of it, LabelModeInfo exports them once per resource in an info
+	// metric instead.
+	LabelModeLabels string = "labels"
+	LabelModeInfo   string = "info"
 )
 
 var (
 	//go:embed metric_filter_config.yml
 	metricsFiltersConfigFile []byte
-
-	metricsFilters map[string]map[string][]string
 )
 
-func GetConfigFromFile(configPath string, enableFilters bool) (*CloudConfig, error) {
+// GetConfigFromFile reads the configuration at configPath. Metric filters are
+// enabled by enableFilters, or by a metric filter file given by
+// metricFiltersPath or the configuration, the former taking precedence. The
+// configuration can be a standard OpenStack clouds.yaml as well, cloudName
+// then selects the cloud to authenticate with.
+func GetConfigFromFile(configPath string, enableFilters bool, metricFiltersPath string, cloudName string) (*CloudConfig, error) {
 	var config CloudConfig
 
 	data, err := os.ReadFile(configPath)
@@ -56,15 +155,39 @@ func GetConfigFromFile(configPath string, enableFilters bool) (*CloudConfig, err
 		return nil, err
 	}
 
-	err = yaml.Unmarshal(data, &config)
+	err = yaml.UnmarshalStrict(data, &config)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSyntax, err)
+	}
+
+	err = expandEnv(reflect.ValueOf(&config))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+
+	err = selectClouds(&config, configPath, cloudName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = resolveAuth(&config)
 	if err != nil {
 		return nil, err
 	}
 
 	setDefaults(&config)
 
-	if enableFilters {
-		err := enableMetricFilters()
+	err = validate(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	if metricFiltersPath != "" {
+		config.Global.MetricFilters = metricFiltersPath
+	}
+
+	if enableFilters || config.Global.MetricFilters != "" {
+		err := enableMetricFilters(&config, enableFilters, config.Global.MetricFilters)
 		if err != nil {
 			return nil, err
 		}
@@ -82,6 +205,10 @@ func setDefaults(config *CloudConfig) {
 		config.Global.MetricsPath = DefaultMetricsPath
 	}
 
+	if config.Global.InternalPath == "" {
+		config.Global.InternalPath = DefaultInternalPath
+	}
+
 	if config.Global.Prefix == "" {
 		config.Global.Prefix = DefaultPrefix
 	}
@@ -93,21 +220,186 @@ func setDefaults(config *CloudConfig) {
 	if config.Global.ScrapeBatchSize == 0 {
 		config.Global.ScrapeBatchSize = DefaultScrapeBatchSize
 	}
+
+	if config.Global.Query.Window == 0 {
+		config.Global.Query.Window = DefaultQueryWindow
+	}
+
+	if config.Global.Query.Period == 0 {
+		config.Global.Query.Period = DefaultQueryPeriod
+	}
+
+	if config.Global.Query.Filter == "" {
+		config.Global.Query.Filter = DefaultQueryFilter
+	}
+
+	if config.Global.ErrorPolicy == "" {
+		config.Global.ErrorPolicy = ErrorPolicyPartial
+	}
+
+	if config.Global.LabelMode == "" {
+		config.Global.LabelMode = LabelModeLabels
+	}
+
+	if config.Global.AggregationMode == "" {
+		config.Global.AggregationMode = AggregationModeSuffix
+	}
+
+	if config.Global.Retry.InitialBackoff == 0 {
+		config.Global.Retry.InitialBackoff = DefaultRetryInitialBackoff
+	}
+
+	if config.Global.Retry.MaxBackoff == 0 {
+		config.Global.Retry.MaxBackoff = DefaultRetryMaxBackoff
+	}
+
+	if config.Global.Discovery.RefreshInterval == 0 {
+		config.Global.Discovery.RefreshInterval = DefaultDiscoveryRefreshInterval
+	}
+
+	if config.Global.ResourceTTL == 0 {
+		config.Global.ResourceTTL = DefaultResourceTTL
+	}
+
+	if config.Global.Polling.Interval == 0 {
+		config.Global.Polling.Interval = DefaultPollingInterval
+	}
+
+	// the single auth block is kept as the default account
+	if len(config.Accounts) == 0 {
+		config.Accounts = []Account{{Name: DefaultAccountName, Auth: config.Auth}}
+	}
+
+	for i := range config.Global.Polling.Namespaces {
+		if config.Global.Polling.Namespaces[i].Interval == 0 {
+			config.Global.Polling.Namespaces[i].Interval = config.Global.Polling.Interval
+		}
+	}
 }
 
-func enableMetricFilters() error {
-	metricsFilters = make(map[string]map[string][]string)
-	err := yaml.Unmarshal(metricsFiltersConfigFile, &metricsFilters)
-	if err != nil {
-		return err
+func validateErrorPolicy(config *CloudConfig) error {
+	if config.Global.ErrorPolicy != ErrorPolicyPartial && config.Global.ErrorPolicy != ErrorPolicyFail {
+		return fmt.Errorf("invalid error policy: %s, valid values are [%s %s]", config.Global.ErrorPolicy, ErrorPolicyPartial, ErrorPolicyFail)
+	}
+
+	return nil
+}
+
+func validateLabelMode(config *CloudConfig) error {
+	if config.Global.LabelMode != LabelModeLabels && config.Global.LabelMode != LabelModeInfo {
+		return fmt.Errorf("invalid label mode: %s, valid values are [%s %s]", config.Global.LabelMode, LabelModeLabels, LabelModeInfo)
+	}
+
+	return nil
+}
+
+// GetMaxRetries returns the number of retries of a failed request.
+func (r Retry) GetMaxRetries() int {
+	if r.MaxRetries == nil {
+		return DefaultRetryMaxRetries
+	}
+
+	return *r.MaxRetries
+}
+
+func validateRetry(config *CloudConfig) error {
+	if config.Global.Retry.GetMaxRetries() < 0 {
+		return fmt.Errorf("invalid max retries: %d, expected 0 to disable the retries or more", config.Global.Retry.GetMaxRetries())
+	}
+
+	if config.Global.Retry.InitialBackoff < 0 || config.Global.Retry.MaxBackoff < 0 {
+		return fmt.Errorf("invalid retry backoff: backoffs must not be negative")
 	}
+
 	return nil
 }
 
-func GetMetricFilters(namespace string) map[string][]string {
-	if configMap, ok := metricsFilters[namespace]; ok {
-		return configMap
+func validateRateLimits(config *CloudConfig) error {
+	limits := map[string]RateLimit{"default": config.Global.RateLimits.Default}
+	for service, limit := range config.Global.RateLimits.Services {
+		limits[service] = limit
+	}
+
+	for service, limit := range limits {
+		if limit.Rate < 0 || limit.Burst < 0 {
+			return fmt.Errorf("invalid rate limit of %s: rate and burst must not be negative", service)
+		}
 	}
 
 	return nil
 }
+
+func validateResourceTTLs(config *CloudConfig) error {
+	if config.Global.ResourceTTL < 0 {
+		return fmt.Errorf("invalid resource ttl: %s", config.Global.ResourceTTL)
+	}
+
+	for namespace, namespaceOptions := range config.Global.Namespaces {
+		if namespaceOptions.ResourceTTL < 0 {
+			return fmt.Errorf("%s: invalid resource ttl: %s", namespace, namespaceOptions.ResourceTTL)
+		}
+	}
+
+	return nil
+}
+
+// GetResourceTTL returns how long the resources of a namespace are cached.
+func (c *CloudConfig) GetResourceTTL(namespace string) time.Duration {
+	if namespaceOptions, ok := c.Global.Namespaces[namespace]; ok && namespaceOptions.ResourceTTL != 0 {
+		return namespaceOptions.ResourceTTL
+	}
+
+	return c.Global.ResourceTTL
+}
+
+// ListsResourcesLike reports whether resources are listed alike with both
+// configurations, i.e. with the same metric filters, tag labels and resource
+// ttls, so that the resources listed with one can be served with the other.
+func (c *CloudConfig) ListsResourcesLike(other *CloudConfig) bool {
+	if !reflect.DeepEqual(c.metricsFilters, other.metricsFilters) ||
+		!reflect.DeepEqual(c.Global.TagLabels, other.Global.TagLabels) ||
+		c.Global.ResourceTTL != other.Global.ResourceTTL {
+		return false
+	}
+
+	for _, namespaces := range []map[string]NamespaceOptions{c.Global.Namespaces, other.Global.Namespaces} {
+		for namespace := range namespaces {
+			if c.GetResourceTTL(namespace) != other.GetResourceTTL(namespace) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func validateAccounts(config *CloudConfig) error {
+	names := make(map[string]struct{})
+	for _, account := range config.Accounts {
+		if account.Name == "" {
+			return fmt.Errorf("accounts must have a name")
+		}
+		if _, ok := names[account.Name]; ok {
+			return fmt.Errorf("duplicate account name: %s", account.Name)
+		}
+		names[account.Name] = struct{}{}
+	}
+
+	return nil
+}
+
+// GetAccount returns the account with the given name, or the first configured
+// account if name is empty.
+func (c *CloudConfig) GetAccount(name string) (*Account, error) {
+	if name == "" {
+		return &c.Accounts[0], nil
+	}
+
+	for i := range c.Accounts {
+		if c.Accounts[i].Name == name {
+			return &c.Accounts[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("account not found: %s", name)
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestListsResourcesLike(t *testing.T) {
+	base := func() *CloudConfig {
+		return &CloudConfig{
+			Global: Global{
+				ResourceTTL: time.Hour,
+				TagLabels:   TagLabels{Keys: []string{"env"}},
+				Namespaces: map[string]NamespaceOptions{
+					"SYS.ELB": {ResourceTTL: time.Minute},
+				},
+			},
+			metricsFilters: map[string]map[string][]string{
+				"SYS.ELB": {"lbaas_instance_id": {"m1"}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(config *CloudConfig)
+		want   bool
+	}{
+		{name: "unchanged", modify: func(config *CloudConfig) {}, want: true},
+		{name: "unrelated change", modify: func(config *CloudConfig) { config.Global.Prefix = "otc" }, want: true},
+		{name: "resource ttl", modify: func(config *CloudConfig) { config.Global.ResourceTTL = time.Minute }},
+		{name: "namespace resource ttl", modify: func(config *CloudConfig) { config.Global.Namespaces["SYS.ELB"] = NamespaceOptions{} }},
+		{name: "tag labels", modify: func(config *CloudConfig) { config.Global.TagLabels.Keys = nil }},
+		{name: "metric filters", modify: func(config *CloudConfig) { config.metricsFilters["SYS.ELB"]["lbaas_instance_id"] = nil }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other := base()
+			tt.modify(other)
+
+			if got := base().ListsResourcesLike(other); got != tt.want {
+				t.Errorf("ListsResourcesLike() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryMaxRetries(t *testing.T) {
+	tests := []struct {
+		name    string
+		retry   string
+		want    int
+		wantErr error
+	}{
+		{name: "default", retry: "initial_backoff: 1s", want: DefaultRetryMaxRetries},
+		{name: "disabled", retry: "max_retries: 0", want: 0},
+		{name: "set", retry: "max_retries: 5", want: 5},
+		{name: "negative", retry: "max_retries: -1", wantErr: ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := writeFile(t, dir, "clouds.yaml", fmt.Sprintf(`
+auth:
+  auth_url: https://iam.example.com/v3
+  project_name: project
+  access_key: ak
+  secret_key: sk
+  region: eu-de
+global:
+  retry:
+    %s
+`, tt.retry))
+
+			config, err := GetConfigFromFile(path, false, "", "")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := config.Global.Retry.GetMaxRetries(); got != tt.want {
+				t.Errorf("GetMaxRetries() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
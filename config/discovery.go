@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Discovery controls which of the namespaces found in CES are scraped with
+// services=all. A namespace is scraped if it fully matches any of the Include
+// patterns, or if there are none, and none of the Exclude patterns.
+type Discovery struct {
+	Include         []string      `yaml:"include"`
+	Exclude         []string      `yaml:"exclude"`
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+const DefaultDiscoveryRefreshInterval time.Duration = time.Hour
+
+func (d Discovery) Matches(namespace string) bool {
+	if len(d.include) > 0 && !matchesAny(d.include, namespace) {
+		return false
+	}
+
+	return !matchesAny(d.exclude, namespace)
+}
+
+func matchesAny(patterns []*regexp.Regexp, value string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+
+	return compiled, nil
+}
+
+func validateDiscovery(config *CloudConfig) error {
+	var err error
+
+	config.Global.Discovery.include, err = compilePatterns(config.Global.Discovery.Include)
+	if err != nil {
+		return fmt.Errorf("discovery include: %w", err)
+	}
+
+	config.Global.Discovery.exclude, err = compilePatterns(config.Global.Discovery.Exclude)
+	if err != nil {
+		return fmt.Errorf("discovery exclude: %w", err)
+	}
+
+	return nil
+}
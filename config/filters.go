@@ -0,0 +1,174 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// MetricFilterRules match metrics by their name and by the comma separated
+// names of their dimensions, e.g. lbaas_instance_id,lbaas_listener_id. Every
+// pattern has to match the whole name.
+type MetricFilterRules struct {
+	Metrics    []string `yaml:"metrics"`
+	Dimensions []string `yaml:"dimensions"`
+
+	metrics    []*regexp.Regexp
+	dimensions []*regexp.Regexp
+}
+
+// NamespaceFilters are the metric filters of a namespace. Metrics lists the
+// metrics to query per combination of dimensions, in the format of the
+// embedded filters. A metric is only queried if it matches the Include rules,
+// if any, and none of the Exclude rules.
+type NamespaceFilters struct {
+	Metrics map[string][]string `yaml:"metrics"`
+	Include MetricFilterRules   `yaml:"include"`
+	Exclude MetricFilterRules   `yaml:"exclude"`
+}
+
+// MetricFilters is the format of a metric filter file. In MetricFiltersModeMerge
+// the lists of metrics of the file replace the embedded ones of the same
+// namespace and dimensions, in MetricFiltersModeReplace the file replaces the
+// embedded filters altogether.
+type MetricFilters struct {
+	Mode       string                      `yaml:"mode"`
+	Namespaces map[string]NamespaceFilters `yaml:"namespaces"`
+}
+
+const (
+	MetricFiltersModeMerge   string = "merge"
+	MetricFiltersModeReplace string = "replace"
+)
+
+func (r *MetricFilterRules) compile() error {
+	var err error
+
+	r.metrics, err = compilePatterns(r.Metrics)
+	if err != nil {
+		return fmt.Errorf("metrics: %w", err)
+	}
+
+	r.dimensions, err = compilePatterns(r.Dimensions)
+	if err != nil {
+		return fmt.Errorf("dimensions: %w", err)
+	}
+
+	return nil
+}
+
+func (r *MetricFilterRules) isEmpty() bool {
+	return len(r.metrics) == 0 && len(r.dimensions) == 0
+}
+
+func (r *MetricFilterRules) matches(metricName string, dimensions string) bool {
+	return matchesAny(r.metrics, metricName) || matchesAny(r.dimensions, dimensions)
+}
+
+func (r *MetricFilterRules) includes(metricName string, dimensions string) bool {
+	if len(r.metrics) > 0 && !matchesAny(r.metrics, metricName) {
+		return false
+	}
+
+	return len(r.dimensions) == 0 || matchesAny(r.dimensions, dimensions)
+}
+
+// enableMetricFilters loads the metric filters. The embedded lists of metrics
+// are used for all namespaces with enableFilters, otherwise only for the
+// namespaces the file at path has lists of, so that a file with nothing but
+// include and exclude rules leaves the metrics listed from CES.
+func enableMetricFilters(config *CloudConfig, enableFilters bool, path string) error {
+	metricsFilters := make(map[string]map[string][]string)
+	metricFilterRules := make(map[string]NamespaceFilters)
+
+	var filters MetricFilters
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		err = yaml.UnmarshalStrict(data, &filters)
+		if err != nil {
+			return fmt.Errorf("%w: parsing metric filters at %s failed: %w", ErrSyntax, path, err)
+		}
+	}
+
+	switch filters.Mode {
+	case "", MetricFiltersModeMerge:
+		err := yaml.Unmarshal(metricsFiltersConfigFile, &metricsFilters)
+		if err != nil {
+			return err
+		}
+		if !enableFilters {
+			for namespace := range metricsFilters {
+				if len(filters.Namespaces[namespace].Metrics) == 0 {
+					delete(metricsFilters, namespace)
+				}
+			}
+		}
+	case MetricFiltersModeReplace:
+	default:
+		return fmt.Errorf("%w: invalid metric filters mode: %s, valid values are [%s %s]", ErrInvalid, filters.Mode, MetricFiltersModeMerge, MetricFiltersModeReplace)
+	}
+
+	for namespace, namespaceFilters := range filters.Namespaces {
+		err := validateNamespace(namespace, false)
+		if err != nil {
+			return fmt.Errorf("%w: metric filters: %w", ErrInvalid, err)
+		}
+
+		err = namespaceFilters.Include.compile()
+		if err != nil {
+			return fmt.Errorf("%w: metric filters of %s: include %w", ErrInvalid, namespace, err)
+		}
+
+		err = namespaceFilters.Exclude.compile()
+		if err != nil {
+			return fmt.Errorf("%w: metric filters of %s: exclude %w", ErrInvalid, namespace, err)
+		}
+
+		metricFilterRules[namespace] = namespaceFilters
+
+		if len(namespaceFilters.Metrics) == 0 {
+			continue
+		}
+		if metricsFilters[namespace] == nil {
+			metricsFilters[namespace] = make(map[string][]string)
+		}
+		for dimensions, metricNames := range namespaceFilters.Metrics {
+			metricsFilters[namespace][dimensions] = metricNames
+		}
+	}
+
+	config.metricsFilters = metricsFilters
+	config.metricFilterRules = metricFilterRules
+	return nil
+}
+
+func (c *CloudConfig) GetMetricFilters(namespace string) map[string][]string {
+	if configMap, ok := c.metricsFilters[namespace]; ok {
+		return configMap
+	}
+
+	return nil
+}
+
+// IsMetricIncluded reports whether a metric passes the include and exclude
+// rules of its namespace.
+func (c *CloudConfig) IsMetricIncluded(namespace string, metricName string, dimensionNames []string) bool {
+	rules, ok := c.metricFilterRules[namespace]
+	if !ok {
+		return true
+	}
+
+	dimensions := strings.Join(dimensionNames, ",")
+	if !rules.Include.isEmpty() && !rules.Include.includes(metricName, dimensions) {
+		return false
+	}
+
+	return !rules.Exclude.matches(metricName, dimensions)
+}
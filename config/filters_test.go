@@ -0,0 +1,165 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestEnableMetricFilters(t *testing.T) {
+	rulesOnly := `
+namespaces:
+  SYS.ECS:
+    exclude:
+      metrics: ["disk_.*"]
+`
+	withLists := `
+namespaces:
+  SYS.ELB:
+    metrics:
+      lbaas_instance_id: [m1_cps]
+`
+	replace := `
+mode: replace
+namespaces:
+  SYS.ELB:
+    metrics:
+      lbaas_instance_id: [m1_cps]
+`
+
+	tests := []struct {
+		name          string
+		enableFilters bool
+		file          string
+		wantELB       []string
+		wantECS       bool
+	}{
+		{name: "disabled"},
+		{name: "embedded", enableFilters: true, wantECS: true},
+		{name: "rules only", file: rulesOnly},
+		{name: "rules with embedded", enableFilters: true, file: rulesOnly, wantECS: true},
+		{name: "lists", file: withLists, wantELB: []string{"m1_cps"}},
+		{name: "lists with embedded", enableFilters: true, file: withLists, wantELB: []string{"m1_cps"}, wantECS: true},
+		{name: "replace", file: replace, wantELB: []string{"m1_cps"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.file != "" {
+				path = writeFile(t, t.TempDir(), "filters.yml", tt.file)
+			}
+
+			var config CloudConfig
+			err := enableMetricFilters(&config, tt.enableFilters, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := config.GetMetricFilters("SYS.ECS") != nil; got != tt.wantECS {
+				t.Errorf("embedded SYS.ECS lists enabled = %v, want %v", got, tt.wantECS)
+			}
+			if tt.wantELB != nil {
+				got := config.GetMetricFilters("SYS.ELB")["lbaas_instance_id"]
+				if len(got) != len(tt.wantELB) || got[0] != tt.wantELB[0] {
+					t.Errorf("SYS.ELB lists = %v, want %v", got, tt.wantELB)
+				}
+			}
+		})
+	}
+}
+
+func TestEnableMetricFiltersMergesListedNamespaces(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "filters.yml", `
+namespaces:
+  SYS.RDS:
+    metrics:
+      rds_cluster_id: [rds001_cpu_util]
+  SYS.ECS:
+    exclude:
+      metrics: ["disk_.*"]
+`)
+
+	var config CloudConfig
+	err := enableMetricFilters(&config, false, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rds := config.GetMetricFilters("SYS.RDS")
+	if got := rds["rds_cluster_id"]; len(got) != 1 || got[0] != "rds001_cpu_util" {
+		t.Errorf("SYS.RDS rds_cluster_id lists = %v, want the list of the file", got)
+	}
+	if len(rds["postgresql_cluster_id"]) == 0 {
+		t.Error("SYS.RDS postgresql_cluster_id lists are empty, want the embedded ones")
+	}
+	for _, namespace := range []string{"SYS.ECS", "SYS.ELB"} {
+		if got := config.GetMetricFilters(namespace); got != nil {
+			t.Errorf("%s lists = %v, want the metrics listed from CES", namespace, got)
+		}
+	}
+}
+
+func TestIsMetricIncluded(t *testing.T) {
+	path := writeFile(t, t.TempDir(), "filters.yml", `
+namespaces:
+  SYS.ECS:
+    include:
+      metrics: ["cpu_.*", "mem_.*"]
+    exclude:
+      metrics: ["mem_usedSize"]
+  SYS.ELB:
+    exclude:
+      dimensions: ["lbaas_instance_id,lbaas_pool_id"]
+`)
+
+	var config CloudConfig
+	err := enableMetricFilters(&config, false, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		namespace  string
+		metricName string
+		dimensions []string
+		want       bool
+	}{
+		{"SYS.ECS", "cpu_util", []string{"instance_id"}, true},
+		{"SYS.ECS", "mem_util", []string{"instance_id"}, true},
+		{"SYS.ECS", "mem_usedSize", []string{"instance_id"}, false},
+		{"SYS.ECS", "disk_util_inband", []string{"instance_id"}, false},
+		{"SYS.ECS", "xcpu_util", []string{"instance_id"}, false},
+		{"SYS.ELB", "m1_cps", []string{"lbaas_instance_id"}, true},
+		{"SYS.ELB", "m1_cps", []string{"lbaas_instance_id", "lbaas_pool_id"}, false},
+		{"SYS.RDS", "rds001_cpu_util", []string{"rds_cluster_id"}, true},
+	}
+
+	for _, tt := range tests {
+		got := config.IsMetricIncluded(tt.namespace, tt.metricName, tt.dimensions)
+		if got != tt.want {
+			t.Errorf("IsMetricIncluded(%s, %s, %v) = %v, want %v", tt.namespace, tt.metricName, tt.dimensions, got, tt.want)
+		}
+	}
+}
+
+func TestEnableMetricFiltersInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{name: "unknown key", file: "namespaces:\n  SYS.ECS:\n    includes: {}\n"},
+		{name: "invalid mode", file: "mode: append\n"},
+		{name: "invalid pattern", file: "namespaces:\n  SYS.ECS:\n    include:\n      metrics: [\"(\"]\n"},
+		{name: "invalid namespace", file: "namespaces:\n  ECS:\n    include:\n      metrics: [\"cpu_.*\"]\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeFile(t, t.TempDir(), "filters.yml", tt.file)
+
+			var config CloudConfig
+			if err := enableMetricFilters(&config, false, path); err == nil {
+				t.Error("invalid metric filters accepted")
+			}
+		})
+	}
+}
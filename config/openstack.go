@@ -0,0 +1,237 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+// OpenStackCloud is an entry of the clouds map of a standard OpenStack
+// clouds.yaml, only the fields needed to authenticate are read and any other
+// one is kept in Extra.
+type OpenStackCloud struct {
+	Auth       OpenStackAuth          `yaml:"auth"`
+	RegionName string                 `yaml:"region_name"`
+	Extra      map[string]interface{} `yaml:",inline"`
+}
+
+type OpenStackAuth struct {
+	AuthURL           string                 `yaml:"auth_url"`
+	Username          string                 `yaml:"username"`
+	Password          string                 `yaml:"password"`
+	ProjectName       string                 `yaml:"project_name"`
+	ProjectID         string                 `yaml:"project_id"`
+	TenantName        string                 `yaml:"tenant_name"`
+	TenantID          string                 `yaml:"tenant_id"`
+	UserID            string                 `yaml:"user_id"`
+	UserDomainName    string                 `yaml:"user_domain_name"`
+	UserDomainID      string                 `yaml:"user_domain_id"`
+	DomainName        string                 `yaml:"domain_name"`
+	DomainID          string                 `yaml:"domain_id"`
+	ProjectDomainName string                 `yaml:"project_domain_name"`
+	ProjectDomainID   string                 `yaml:"project_domain_id"`
+	AK                string                 `yaml:"ak"`
+	SK                string                 `yaml:"sk"`
+	AccessKey         string                 `yaml:"access_key"`
+	SecretKey         string                 `yaml:"secret_key"`
+	Extra             map[string]interface{} `yaml:",inline"`
+}
+
+type secureClouds struct {
+	Clouds map[string]OpenStackCloud `yaml:"clouds"`
+}
+
+// merge overrides the fields of the cloud with the ones set in other, as the
+// entries of secure.yaml do with the ones of clouds.yaml.
+func (c *OpenStackCloud) merge(other OpenStackCloud) {
+	fields := map[*string]string{
+		&c.RegionName:             other.RegionName,
+		&c.Auth.AuthURL:           other.Auth.AuthURL,
+		&c.Auth.Username:          other.Auth.Username,
+		&c.Auth.Password:          other.Auth.Password,
+		&c.Auth.ProjectName:       other.Auth.ProjectName,
+		&c.Auth.ProjectID:         other.Auth.ProjectID,
+		&c.Auth.TenantName:        other.Auth.TenantName,
+		&c.Auth.TenantID:          other.Auth.TenantID,
+		&c.Auth.UserID:            other.Auth.UserID,
+		&c.Auth.UserDomainName:    other.Auth.UserDomainName,
+		&c.Auth.UserDomainID:      other.Auth.UserDomainID,
+		&c.Auth.DomainName:        other.Auth.DomainName,
+		&c.Auth.DomainID:          other.Auth.DomainID,
+		&c.Auth.ProjectDomainName: other.Auth.ProjectDomainName,
+		&c.Auth.ProjectDomainID:   other.Auth.ProjectDomainID,
+		&c.Auth.AK:                other.Auth.AK,
+		&c.Auth.SK:                other.Auth.SK,
+		&c.Auth.AccessKey:         other.Auth.AccessKey,
+		&c.Auth.SecretKey:         other.Auth.SecretKey,
+	}
+
+	for field, value := range fields {
+		if value != "" {
+			*field = value
+		}
+	}
+}
+
+// toCloudAuth maps the cloud onto the auth block of the exporter. Of the name
+// and id of the project, the domain and the user only one is taken, the id if
+// given, and the domain is taken from a single one of the user, plain and
+// project domain keys, in that order.
+func (c *OpenStackCloud) toCloudAuth() CloudAuth {
+	auth := CloudAuth{
+		AuthURL:   c.Auth.AuthURL,
+		Region:    c.RegionName,
+		Password:  c.Auth.Password,
+		AccessKey: firstNonEmpty(c.Auth.AK, c.Auth.AccessKey),
+		SecretKey: firstNonEmpty(c.Auth.SK, c.Auth.SecretKey),
+	}
+
+	auth.ProjectName, auth.ProjectID = nameOrID(firstNonEmpty(c.Auth.ProjectName, c.Auth.TenantName), firstNonEmpty(c.Auth.ProjectID, c.Auth.TenantID))
+	auth.UserName, auth.UserID = nameOrID(c.Auth.Username, c.Auth.UserID)
+
+	domains := [][2]string{
+		{c.Auth.UserDomainName, c.Auth.UserDomainID},
+		{c.Auth.DomainName, c.Auth.DomainID},
+		{c.Auth.ProjectDomainName, c.Auth.ProjectDomainID},
+	}
+	for _, domain := range domains {
+		if domain[0] != "" || domain[1] != "" {
+			auth.DomainName, auth.DomainID = nameOrID(domain[0], domain[1])
+			break
+		}
+	}
+
+	return auth
+}
+
+// nameOrID returns the id, if given, or else the name.
+func nameOrID(name string, id string) (string, string) {
+	if id != "" {
+		return "", id
+	}
+
+	return name, ""
+}
+
+// fill sets the fields omitted in the auth block from the given one.
+func (a *CloudAuth) fill(other CloudAuth) {
+	identified := a.identified()
+	fields := map[*string]string{
+		&a.AuthURL:     other.AuthURL,
+		&a.Region:      other.Region,
+		&a.ProjectName: other.ProjectName,
+		&a.ProjectID:   other.ProjectID,
+		&a.DomainName:  other.DomainName,
+		&a.DomainID:    other.DomainID,
+		&a.UserName:    other.UserName,
+		&a.UserID:      other.UserID,
+		&a.Password:    other.Password,
+		&a.AccessKey:   other.AccessKey,
+		&a.SecretKey:   other.SecretKey,
+	}
+
+	for field, value := range fields {
+		if *field == "" && !identified[field] {
+			*field = value
+		}
+	}
+}
+
+// getSecureFilePath returns the path of the secure.yaml holding the secrets of
+// the clouds, given by OS_CLIENT_SECURE_FILE or next to the configuration.
+func getSecureFilePath(configPath string) string {
+	if path := os.Getenv("OS_CLIENT_SECURE_FILE"); path != "" {
+		return path
+	}
+
+	return filepath.Join(filepath.Dir(configPath), "secure.yaml")
+}
+
+// selectClouds maps the clouds of a standard OpenStack clouds.yaml onto the
+// auth blocks: every account naming a cloud gets its auth, and without
+// accounts the cloud selected by cloudName, OS_CLOUD or being the only one
+// becomes the auth block. Fields set in the auth blocks take precedence.
+func selectClouds(config *CloudConfig, configPath string, cloudName string) error {
+	if len(config.Clouds) == 0 {
+		if cloudName != "" {
+			return fmt.Errorf("%w: cloud not found: %s, the config has no clouds", ErrInvalid, cloudName)
+		}
+		return nil
+	}
+
+	securePath := getSecureFilePath(configPath)
+	data, err := os.ReadFile(securePath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		var secure secureClouds
+		err = yaml.UnmarshalStrict(data, &secure)
+		if err != nil {
+			return fmt.Errorf("%w: parsing %s failed: %w", ErrSyntax, securePath, err)
+		}
+
+		err = expandEnv(reflect.ValueOf(&secure))
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrInvalid, securePath, err)
+		}
+
+		for name, secureCloud := range secure.Clouds {
+			cloud := config.Clouds[name]
+			cloud.merge(secureCloud)
+			config.Clouds[name] = cloud
+		}
+		config.secureFile = securePath
+	}
+
+	for i := range config.Accounts {
+		name := config.Accounts[i].Cloud
+		if name == "" {
+			continue
+		}
+
+		cloud, ok := config.Clouds[name]
+		if !ok {
+			return fmt.Errorf("%w: account %s: cloud not found: %s", ErrInvalid, config.Accounts[i].Name, name)
+		}
+		config.Accounts[i].Auth.fill(cloud.toCloudAuth())
+	}
+
+	if len(config.Accounts) > 0 {
+		return nil
+	}
+
+	if cloudName == "" {
+		cloudName = os.Getenv("OS_CLOUD")
+	}
+	if cloudName == "" && len(config.Clouds) == 1 {
+		for name := range config.Clouds {
+			cloudName = name
+		}
+	}
+	if cloudName == "" {
+		return fmt.Errorf("%w: the config has several clouds, select one with -cloud or OS_CLOUD", ErrInvalid)
+	}
+
+	cloud, ok := config.Clouds[cloudName]
+	if !ok {
+		return fmt.Errorf("%w: cloud not found: %s", ErrInvalid, cloudName)
+	}
+	config.Auth.fill(cloud.toCloudAuth())
+
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
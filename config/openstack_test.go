@@ -0,0 +1,127 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestToCloudAuth(t *testing.T) {
+	tests := []struct {
+		name  string
+		cloud OpenStackCloud
+		want  CloudAuth
+	}{
+		{
+			name: "project name and id",
+			cloud: OpenStackCloud{Auth: OpenStackAuth{
+				ProjectName: "eu-de_project", ProjectID: "project-id",
+				Username: "user", UserDomainName: "OTC-EU-DE-0001",
+			}},
+			want: CloudAuth{ProjectID: "project-id", UserName: "user", DomainName: "OTC-EU-DE-0001"},
+		},
+		{
+			name: "tenant name",
+			cloud: OpenStackCloud{Auth: OpenStackAuth{
+				TenantName: "eu-de_project", AK: "ak", SK: "sk",
+			}, RegionName: "eu-de"},
+			want: CloudAuth{ProjectName: "eu-de_project", AccessKey: "ak", SecretKey: "sk", Region: "eu-de"},
+		},
+		{
+			name: "user and project domain",
+			cloud: OpenStackCloud{Auth: OpenStackAuth{
+				UserDomainName: "user-domain", ProjectDomainID: "project-domain-id",
+			}},
+			want: CloudAuth{DomainName: "user-domain"},
+		},
+		{
+			name: "domain name and id",
+			cloud: OpenStackCloud{Auth: OpenStackAuth{
+				DomainName: "domain", DomainID: "domain-id", UserID: "user-id", Username: "user",
+			}},
+			want: CloudAuth{DomainID: "domain-id", UserID: "user-id"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.cloud.toCloudAuth()
+			if got != tt.want {
+				t.Errorf("toCloudAuth() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetConfigFromFileClouds(t *testing.T) {
+	t.Setenv("OS_CLOUD", "")
+	t.Setenv("OS_CLIENT_SECURE_FILE", "")
+
+	dir := t.TempDir()
+	path := writeFile(t, dir, "clouds.yaml", `
+clouds:
+  otc:
+    auth:
+      auth_url: https://iam.eu-de.otc.t-systems.com/v3
+      username: user
+      project_name: eu-de_project
+      project_id: project-id
+      user_domain_name: OTC-EU-DE-0001
+      project_domain_id: domain-id
+    region_name: eu-de
+    interface: public
+    identity_api_version: 3
+  other:
+    auth:
+      auth_url: https://iam.eu-nl.otc.t-systems.com/v3
+      ak: ak
+      sk: sk
+      project_name: eu-nl
+    region_name: eu-nl
+`)
+	writeFile(t, dir, "secure.yaml", `
+clouds:
+  otc:
+    auth:
+      password: secret
+`)
+
+	tests := []struct {
+		name      string
+		cloudName string
+		osCloud   string
+		want      CloudAuth
+		wantErr   bool
+	}{
+		{name: "no selection", wantErr: true},
+		{name: "unknown cloud", cloudName: "missing", wantErr: true},
+		{
+			name:      "flag",
+			cloudName: "otc",
+			want: CloudAuth{
+				AuthURL: "https://iam.eu-de.otc.t-systems.com/v3", Region: "eu-de", ProjectID: "project-id",
+				UserName: "user", Password: "secret", DomainName: "OTC-EU-DE-0001",
+			},
+		},
+		{
+			name:    "environment",
+			osCloud: "other",
+			want: CloudAuth{
+				AuthURL: "https://iam.eu-nl.otc.t-systems.com/v3", Region: "eu-nl", ProjectName: "eu-nl",
+				AccessKey: "ak", SecretKey: "sk",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OS_CLOUD", tt.osCloud)
+
+			config, err := GetConfigFromFile(path, false, "", tt.cloudName)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetConfigFromFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && config.Accounts[0].Auth != tt.want {
+				t.Errorf("auth = %+v, want %+v", config.Accounts[0].Auth, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+)
+
+// Profile is a named set of namespaces, selected with the profile url
+// parameter, that can override the query options and the batch size of the
+// scrapes using it. A profile can be given as a plain list of namespaces too.
+type Profile struct {
+	Services        []string `yaml:"services"`
+	QueryOptions    `yaml:",inline"`
+	ScrapeBatchSize int `yaml:"scrape_batch_size"`
+}
+
+func (p *Profile) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var services []string
+	if err := unmarshal(&services); err == nil {
+		p.Services = services
+		return nil
+	}
+
+	type plain Profile
+	return unmarshal((*plain)(p))
+}
+
+// GetProfile returns the profile with the given name.
+func (c *CloudConfig) GetProfile(name string) (*Profile, error) {
+	profile, ok := c.Global.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile not found: %s", name)
+	}
+
+	return &profile, nil
+}
+
+func validateProfiles(config *CloudConfig) error {
+	for name, profile := range config.Global.Profiles {
+		if len(profile.Services) == 0 {
+			return fmt.Errorf("profile %s: services must not be empty", name)
+		}
+
+		if profile.ScrapeBatchSize < 0 {
+			return fmt.Errorf("profile %s: invalid scrape batch size: %d", name, profile.ScrapeBatchSize)
+		}
+
+		err := profile.QueryOptions.Validate()
+		if err != nil {
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
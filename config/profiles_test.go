@@ -0,0 +1,93 @@
+package config
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGetProfile(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "clouds.yaml", `
+auth:
+  auth_url: https://iam.example.com/v3
+  project_name: project
+  access_key: ak
+  secret_key: sk
+  region: eu-de
+global:
+  default_services: [SYS.ECS, SYS.RDS]
+  profiles:
+    network: [SYS.ELB, SYS.VPC]
+    slow:
+      services: [SYS.DMS]
+      window: 30m
+      period: 300
+      scrape_batch_size: 5
+`)
+
+	config, err := GetConfigFromFile(path, false, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(config.Global.DefaultServices, []string{"SYS.ECS", "SYS.RDS"}) {
+		t.Errorf("default services = %v, want [SYS.ECS SYS.RDS]", config.Global.DefaultServices)
+	}
+
+	network, err := config.GetProfile("network")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(network.Services, []string{"SYS.ELB", "SYS.VPC"}) || network.ScrapeBatchSize != 0 {
+		t.Errorf("network = %+v, want the listed services only", network)
+	}
+
+	slow, err := config.GetProfile("slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(slow.Services, []string{"SYS.DMS"}) || slow.Window != 30*time.Minute || slow.Period != 300 || slow.ScrapeBatchSize != 5 {
+		t.Errorf("slow = %+v, want its services, query options and batch size", slow)
+	}
+
+	if _, err := config.GetProfile("missing"); err == nil {
+		t.Error("GetProfile() of a missing profile returned no error")
+	}
+}
+
+func TestValidateProfiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		global  string
+		wantErr bool
+	}{
+		{name: "all", global: "profiles: {everything: [all]}"},
+		{name: "invalid default service", global: "default_services: [ELB]", wantErr: true},
+		{name: "invalid service", global: "profiles: {network: [SYS.ELB, VPC]}", wantErr: true},
+		{name: "no services", global: "profiles: {empty: {window: 10m}}", wantErr: true},
+		{name: "negative batch size", global: "profiles: {slow: {services: [SYS.DMS], scrape_batch_size: -1}}", wantErr: true},
+		{name: "invalid period", global: "profiles: {slow: {services: [SYS.DMS], period: 60}}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := writeFile(t, dir, "clouds.yaml", `
+auth:
+  auth_url: https://iam.example.com/v3
+  project_name: project
+  access_key: ak
+  secret_key: sk
+  region: eu-de
+global:
+  `+tt.global+`
+`)
+
+			_, err := GetConfigFromFile(path, false, "", "")
+			if tt.wantErr != errors.Is(err, ErrInvalid) || (!tt.wantErr && err != nil) {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// QueryOptions control how CES is queried for the data of a metric. Options
+// left empty are inherited from the enclosing level, per metric options
+// override per namespace options, which override the global ones.
+// AdditionalFilters opt in to export further aggregations of a metric next to
+// the one of Filter.
+type QueryOptions struct {
+	Window            time.Duration `yaml:"window"`
+	Period            int           `yaml:"period"`
+	Filter            string        `yaml:"filter"`
+	AdditionalFilters []string      `yaml:"additional_filters"`
+}
+
+type NamespaceOptions struct {
+	QueryOptions `yaml:",inline"`
+	Metrics      map[string]QueryOptions `yaml:"metrics"`
+	ResourceTTL  time.Duration           `yaml:"resource_ttl"`
+}
+
+const (
+	DefaultQueryWindow time.Duration = time.Minute * 10
+	DefaultQueryPeriod int           = 1
+	DefaultQueryFilter string        = "average"
+
+	AggregationModeSuffix string = "suffix"
+	AggregationModeLabel  string = "label"
+)
+
+var (
+	validPeriods = []int{1, 300, 1200, 3600, 14400, 86400}
+	validFilters = []string{"average", "max", "min", "sum", "variance"}
+
+	validAggregationModes = []string{AggregationModeSuffix, AggregationModeLabel}
+)
+
+// Merge returns a copy of the options, with every option that is set in
+// overrides replaced.
+func (o QueryOptions) Merge(overrides QueryOptions) QueryOptions {
+	if overrides.Window != 0 {
+		o.Window = overrides.Window
+	}
+
+	if overrides.Period != 0 {
+		o.Period = overrides.Period
+	}
+
+	if overrides.Filter != "" {
+		o.Filter = overrides.Filter
+	}
+
+	if overrides.AdditionalFilters != nil {
+		o.AdditionalFilters = overrides.AdditionalFilters
+	}
+
+	return o
+}
+
+func (o QueryOptions) Validate() error {
+	if o.Window < 0 {
+		return fmt.Errorf("invalid query window: %s", o.Window)
+	}
+
+	if o.Period != 0 && !slices.Contains(validPeriods, o.Period) {
+		return fmt.Errorf("invalid query period: %d, valid values are %v", o.Period, validPeriods)
+	}
+
+	if o.Filter != "" && !slices.Contains(validFilters, o.Filter) {
+		return fmt.Errorf("invalid query filter: %s, valid values are %v", o.Filter, validFilters)
+	}
+
+	for _, filter := range o.AdditionalFilters {
+		if !slices.Contains(validFilters, filter) {
+			return fmt.Errorf("invalid additional query filter: %s, valid values are %v", filter, validFilters)
+		}
+	}
+
+	return nil
+}
+
+// GetQueryOptions resolves the query options of a metric of a namespace.
+func (c *CloudConfig) GetQueryOptions(namespace string, metricName string) QueryOptions {
+	options := c.Global.Query
+
+	if namespaceOptions, ok := c.Global.Namespaces[namespace]; ok {
+		options = options.Merge(namespaceOptions.QueryOptions)
+		if metricOptions, ok := namespaceOptions.Metrics[metricName]; ok {
+			options = options.Merge(metricOptions)
+		}
+	}
+
+	return options
+}
+
+func validateQueryOptions(config *CloudConfig) error {
+	if !slices.Contains(validAggregationModes, config.Global.AggregationMode) {
+		return fmt.Errorf("invalid aggregation mode: %s, valid values are %v", config.Global.AggregationMode, validAggregationModes)
+	}
+
+	err := config.Global.Query.Validate()
+	if err != nil {
+		return err
+	}
+
+	for namespace, namespaceOptions := range config.Global.Namespaces {
+		err := namespaceOptions.Validate()
+		if err != nil {
+			return fmt.Errorf("%s: %w", namespace, err)
+		}
+
+		for metricName, metricOptions := range namespaceOptions.Metrics {
+			err := metricOptions.Validate()
+			if err != nil {
+				return fmt.Errorf("%s/%s: %w", namespace, metricName, err)
+			}
+		}
+	}
+
+	return nil
+}
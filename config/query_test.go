@@ -0,0 +1,89 @@
+package config
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGetQueryOptions(t *testing.T) {
+	config := &CloudConfig{Global: Global{
+		Query: QueryOptions{Window: 10 * time.Minute, Period: 1, Filter: "average"},
+		Namespaces: map[string]NamespaceOptions{
+			"SYS.ELB": {
+				QueryOptions: QueryOptions{Period: 300, AdditionalFilters: []string{"max"}},
+				Metrics: map[string]QueryOptions{
+					"m1_cps": {Filter: "sum", AdditionalFilters: []string{}},
+				},
+			},
+		},
+	}}
+
+	tests := []struct {
+		name       string
+		namespace  string
+		metricName string
+		overrides  QueryOptions
+		want       QueryOptions
+	}{
+		{
+			name:       "global",
+			namespace:  "SYS.RDS",
+			metricName: "rds001_cpu_util",
+			want:       QueryOptions{Window: 10 * time.Minute, Period: 1, Filter: "average"},
+		},
+		{
+			name:       "namespace",
+			namespace:  "SYS.ELB",
+			metricName: "m2_act_conn",
+			want:       QueryOptions{Window: 10 * time.Minute, Period: 300, Filter: "average", AdditionalFilters: []string{"max"}},
+		},
+		{
+			name:       "metric",
+			namespace:  "SYS.ELB",
+			metricName: "m1_cps",
+			want:       QueryOptions{Window: 10 * time.Minute, Period: 300, Filter: "sum", AdditionalFilters: []string{}},
+		},
+		{
+			name:       "overrides",
+			namespace:  "SYS.ELB",
+			metricName: "m1_cps",
+			overrides:  QueryOptions{Window: time.Hour, Filter: "max"},
+			want:       QueryOptions{Window: time.Hour, Period: 300, Filter: "max", AdditionalFilters: []string{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := config.GetQueryOptions(tt.namespace, tt.metricName).Merge(tt.overrides)
+			if got.Window != tt.want.Window || got.Period != tt.want.Period || got.Filter != tt.want.Filter ||
+				!slices.Equal(got.AdditionalFilters, tt.want.AdditionalFilters) {
+				t.Errorf("query options = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options QueryOptions
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "valid", options: QueryOptions{Window: time.Hour, Period: 300, Filter: "max", AdditionalFilters: []string{"min"}}},
+		{name: "negative window", options: QueryOptions{Window: -time.Minute}, wantErr: true},
+		{name: "invalid period", options: QueryOptions{Period: 60}, wantErr: true},
+		{name: "invalid filter", options: QueryOptions{Filter: "avg"}, wantErr: true},
+		{name: "invalid additional filter", options: QueryOptions{AdditionalFilters: []string{"max", "p99"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
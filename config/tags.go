@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// TagLabels exports the tags with the given keys of the resources as labels,
+// named after the key prefixed with Prefix, or DefaultTagLabelPrefix if no
+// prefix is given; an empty prefix exports the tags under their keys alone.
+// Resources lacking one of the tags get Default as its value.
+type TagLabels struct {
+	Keys    []string `yaml:"keys"`
+	Prefix  *string  `yaml:"prefix"`
+	Default string   `yaml:"default"`
+}
+
+const DefaultTagLabelPrefix string = "tag_"
+
+var (
+	invalidLabelNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+	// reservedLabelNames are the labels the exporter attaches to the series
+	// itself.
+	reservedLabelNames = []string{"account", "project", "region", "aggregation"}
+)
+
+// LabelNames returns the label names of the tag keys, in the same order.
+func (t TagLabels) LabelNames() []string {
+	prefix := DefaultTagLabelPrefix
+	if t.Prefix != nil {
+		prefix = *t.Prefix
+	}
+
+	names := make([]string, 0, len(t.Keys))
+	for _, key := range t.Keys {
+		names = append(names, sanitizeLabelName(prefix+key))
+	}
+
+	return names
+}
+
+func sanitizeLabelName(name string) string {
+	name = strings.ToLower(invalidLabelNameChars.ReplaceAllString(name, "_"))
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// validateTagLabels checks that the label names of the tag keys are distinct,
+// and that none of them collides with the labels of the exporter or with the
+// dimensions of the embedded metric filters.
+func validateTagLabels(config *CloudConfig) error {
+	dimensions, err := getDimensionLabelNames()
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]string)
+	labelNames := config.Global.TagLabels.LabelNames()
+	for i, key := range config.Global.TagLabels.Keys {
+		name := labelNames[i]
+		switch {
+		case key == "":
+			return fmt.Errorf("tag label keys must not be empty")
+		case strings.HasPrefix(name, "__"):
+			return fmt.Errorf("tag key %s maps to label %s, labels starting with __ are reserved", key, name)
+		case slices.Contains(reservedLabelNames, name):
+			return fmt.Errorf("tag key %s maps to label %s of the exporter", key, name)
+		case dimensions[name]:
+			return fmt.Errorf("tag key %s maps to label %s of a dimension", key, name)
+		}
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("tag keys %s and %s both map to label %s", other, key, name)
+		}
+		names[name] = key
+	}
+
+	return nil
+}
+
+// getDimensionLabelNames returns the label names of the dimensions of the
+// embedded metric filters.
+func getDimensionLabelNames() (map[string]bool, error) {
+	var metricsFilters map[string]map[string][]string
+	err := yaml.Unmarshal(metricsFiltersConfigFile, &metricsFilters)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for _, namespaceFilters := range metricsFilters {
+		for dimensions := range namespaceFilters {
+			for _, dimension := range strings.Split(dimensions, ",") {
+				names[strings.ReplaceAll(dimension, "-", "_")] = true
+			}
+		}
+	}
+
+	return names, nil
+}
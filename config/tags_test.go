@@ -0,0 +1,64 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTagLabelNames(t *testing.T) {
+	empty := ""
+	custom := "t_"
+
+	tests := []struct {
+		name   string
+		prefix *string
+		want   []string
+	}{
+		{name: "default prefix", want: []string{"tag_costcenter", "tag_team_name"}},
+		{name: "empty prefix", prefix: &empty, want: []string{"costcenter", "team_name"}},
+		{name: "custom prefix", prefix: &custom, want: []string{"t_costcenter", "t_team_name"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tagLabels := TagLabels{Keys: []string{"CostCenter", "team-name"}, Prefix: tt.prefix}
+			if got := tagLabels.LabelNames(); !slices.Equal(got, tt.want) {
+				t.Errorf("LabelNames() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTagLabels(t *testing.T) {
+	empty := ""
+
+	tests := []struct {
+		name    string
+		keys    []string
+		prefix  *string
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "distinct", keys: []string{"CostCenter", "team"}},
+		{name: "dimension with prefix", keys: []string{"instance_id"}},
+		{name: "same label", keys: []string{"team-name", "team_name"}, wantErr: true},
+		{name: "same label in other case", keys: []string{"Team", "team"}, wantErr: true},
+		{name: "empty key", keys: []string{""}, wantErr: true},
+		{name: "exporter label", keys: []string{"region"}, prefix: &empty, wantErr: true},
+		{name: "dimension", keys: []string{"instance_id"}, prefix: &empty, wantErr: true},
+		{name: "dimension with dash", keys: []string{"instance-id"}, prefix: &empty, wantErr: true},
+		{name: "reserved prefix", keys: []string{"__name"}, prefix: &empty, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &CloudConfig{}
+			config.Global.TagLabels = TagLabels{Keys: tt.keys, Prefix: tt.prefix}
+
+			err := validateTagLabels(config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateTagLabels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
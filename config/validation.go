@@ -0,0 +1,215 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrSyntax is wrapped by the errors of configuration and metric filter
+	// files that cannot be parsed, e.g. because of an unknown key.
+	ErrSyntax = errors.New("syntax error")
+
+	// ErrInvalid is wrapped by the errors of configurations that parse but
+	// fail validation.
+	ErrInvalid = errors.New("invalid configuration")
+)
+
+var (
+	prefixPattern    = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	namespacePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+$`)
+
+	// reservedPaths are served by the exporter besides the metrics paths.
+	reservedPaths = []string{"/", "/-/reload", "/healthz", "/livez", "/readyz"}
+)
+
+// validate runs every validation of the configuration, in order, and returns
+// the first error wrapped in ErrInvalid.
+func validate(config *CloudConfig) error {
+	validations := []func(config *CloudConfig) error{
+		validateListener,
+		validateAccounts,
+		validateAuth,
+		validateNamespaces,
+		validateQueryOptions,
+		validateErrorPolicy,
+		validateLabelMode,
+		validateTagLabels,
+		validateDiscovery,
+		validateProfiles,
+		validateRetry,
+		validateRateLimits,
+		validateResourceTTLs,
+	}
+
+	for _, validation := range validations {
+		err := validation(config)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalid, err)
+		}
+	}
+
+	return nil
+}
+
+func validateListener(config *CloudConfig) error {
+	_, port, err := net.SplitHostPort(config.Global.Port)
+	if err != nil {
+		return fmt.Errorf("invalid port: %s, expected [host]:port", config.Global.Port)
+	}
+	number, err := strconv.Atoi(port)
+	if err != nil || number < 1 || number > 65535 {
+		return fmt.Errorf("invalid port: %s, expected a number between 1 and 65535", port)
+	}
+
+	if !prefixPattern.MatchString(config.Global.Prefix) {
+		return fmt.Errorf("invalid prefix: %s, expected a valid metric name", config.Global.Prefix)
+	}
+
+	paths := map[string]string{
+		"metrics_path":          config.Global.MetricsPath,
+		"internal_metrics_path": config.Global.InternalPath,
+	}
+	for key, path := range paths {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("invalid %s: %s, expected an absolute path", key, path)
+		}
+		if slices.Contains(reservedPaths, path) {
+			return fmt.Errorf("invalid %s: %s, the path is reserved", key, path)
+		}
+	}
+	if config.Global.MetricsPath == config.Global.InternalPath {
+		return fmt.Errorf("metrics_path and internal_metrics_path must differ: %s", config.Global.MetricsPath)
+	}
+
+	return nil
+}
+
+// validateAuth checks that every account is complete for its auth method,
+// an access key and secret key, or else a user and password, and that no
+// project, domain or user is given by both name and id, as they could
+// contradict each other.
+func validateAuth(config *CloudConfig) error {
+	for _, account := range config.Accounts {
+		err := account.Auth.validate()
+		if err != nil {
+			return fmt.Errorf("account %s: %w", account.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func (a *CloudAuth) validate() error {
+	for _, entity := range []string{"project", "domain", "user"} {
+		pair := a.identityPairs()[entity]
+		if *pair[0] != "" && *pair[1] != "" {
+			return fmt.Errorf("contradictory auth, only one of %s_name and %s_id may be set", entity, entity)
+		}
+	}
+
+	missing := make([]string, 0)
+	if a.AuthURL == "" {
+		missing = append(missing, "auth_url")
+	}
+	if a.Region == "" {
+		missing = append(missing, "region")
+	}
+	if a.ProjectName == "" && a.ProjectID == "" {
+		missing = append(missing, "project_name or project_id")
+	}
+
+	switch {
+	case a.AccessKey != "" || a.SecretKey != "":
+		if a.AccessKey == "" {
+			missing = append(missing, "access_key")
+		}
+		if a.SecretKey == "" {
+			missing = append(missing, "secret_key")
+		}
+	case a.UserName != "" || a.UserID != "" || a.Password != "":
+		if a.UserName == "" && a.UserID == "" {
+			missing = append(missing, "user_name or user_id")
+		}
+		if a.Password == "" {
+			missing = append(missing, "password")
+		}
+		// user ids are unique across domains, user names only within one
+		if a.UserID == "" && a.DomainName == "" && a.DomainID == "" {
+			missing = append(missing, "domain_name or domain_id")
+		}
+		// a user id leaves no domain to scope a project name with
+		if a.UserID != "" && a.ProjectID == "" {
+			missing = append(missing, "project_id, required with user_id")
+		}
+	default:
+		missing = append(missing, "access_key and secret_key, or user_name and password")
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("incomplete auth, missing %s", strings.Join(missing, "; "))
+	}
+
+	return nil
+}
+
+// validateNamespaces checks the namespace names given anywhere in the
+// configuration, e.g. SYS.ELB.
+func validateNamespaces(config *CloudConfig) error {
+	for _, namespace := range config.Global.DefaultServices {
+		err := validateNamespace(namespace, true)
+		if err != nil {
+			return fmt.Errorf("default services: %w", err)
+		}
+	}
+
+	for name, profile := range config.Global.Profiles {
+		for _, namespace := range profile.Services {
+			err := validateNamespace(namespace, true)
+			if err != nil {
+				return fmt.Errorf("profile %s: %w", name, err)
+			}
+		}
+	}
+
+	for _, pollingNamespace := range config.Global.Polling.Namespaces {
+		err := validateNamespace(pollingNamespace.Namespace, false)
+		if err != nil {
+			return fmt.Errorf("polling: %w", err)
+		}
+		if pollingNamespace.Account == "" {
+			continue
+		}
+		if _, err := config.GetAccount(pollingNamespace.Account); err != nil {
+			return fmt.Errorf("polling %s: %w", pollingNamespace.Namespace, err)
+		}
+	}
+
+	for namespace := range config.Global.Namespaces {
+		err := validateNamespace(namespace, false)
+		if err != nil {
+			return fmt.Errorf("namespaces: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// validateNamespace checks the name of a namespace, allowAll accepts the
+// services=all value as well.
+func validateNamespace(namespace string, allowAll bool) error {
+	if allowAll && namespace == "all" {
+		return nil
+	}
+
+	if !namespacePattern.MatchString(namespace) {
+		return fmt.Errorf("invalid namespace: %s, expected e.g. SYS.ELB", namespace)
+	}
+
+	return nil
+}
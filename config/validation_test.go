@@ -0,0 +1,190 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGetConfigFromFileStrict(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "clouds.yaml", `
+auth:
+  auth_url: https://iam.example.com/v3
+  project_name: project
+  access_key: ak
+  secret_key: sk
+  region: eu-de
+global:
+  prot: ":8087"
+`)
+
+	_, err := GetConfigFromFile(path, false, "", "")
+	if !errors.Is(err, ErrSyntax) {
+		t.Fatalf("error = %v, want %v", err, ErrSyntax)
+	}
+	if !strings.Contains(err.Error(), "line 9") || !strings.Contains(err.Error(), "prot") {
+		t.Errorf("error = %v, want the line and name of the unknown key", err)
+	}
+}
+
+func TestGetConfigFromFileInvalid(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "clouds.yaml", `
+auth:
+  auth_url: https://iam.example.com/v3
+  project_name: project
+  access_key: ak
+  secret_key: sk
+  region: eu-de
+global:
+  port: ":99999"
+`)
+
+	_, err := GetConfigFromFile(path, false, "", "")
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("error = %v, want %v", err, ErrInvalid)
+	}
+}
+
+func TestValidateListener(t *testing.T) {
+	valid := Global{
+		Port:         ":8087",
+		Prefix:       DefaultPrefix,
+		MetricsPath:  DefaultMetricsPath,
+		InternalPath: DefaultInternalPath,
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(global *Global)
+		wantErr bool
+	}{
+		{name: "valid", modify: func(global *Global) {}},
+		{name: "host and port", modify: func(global *Global) { global.Port = "127.0.0.1:8087" }},
+		{name: "port without colon", modify: func(global *Global) { global.Port = "8087" }, wantErr: true},
+		{name: "port out of range", modify: func(global *Global) { global.Port = ":0" }, wantErr: true},
+		{name: "port not a number", modify: func(global *Global) { global.Port = ":http" }, wantErr: true},
+		{name: "invalid prefix", modify: func(global *Global) { global.Prefix = "open-telekom" }, wantErr: true},
+		{name: "relative path", modify: func(global *Global) { global.MetricsPath = "metrics" }, wantErr: true},
+		{name: "reserved path", modify: func(global *Global) { global.InternalPath = "/healthz" }, wantErr: true},
+		{name: "same paths", modify: func(global *Global) { global.InternalPath = global.MetricsPath }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &CloudConfig{Global: valid}
+			tt.modify(&config.Global)
+
+			err := validateListener(config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateListener() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCloudAuthValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		auth    CloudAuth
+		wantErr bool
+	}{
+		{
+			name: "ak/sk",
+			auth: CloudAuth{AuthURL: "https://iam", Region: "eu-de", ProjectName: "p", AccessKey: "ak", SecretKey: "sk"},
+		},
+		{
+			name:    "ak without sk",
+			auth:    CloudAuth{AuthURL: "https://iam", Region: "eu-de", ProjectName: "p", AccessKey: "ak"},
+			wantErr: true,
+		},
+		{
+			name: "password",
+			auth: CloudAuth{AuthURL: "https://iam", Region: "eu-de", ProjectName: "p", DomainName: "d", UserName: "u", Password: "pw"},
+		},
+		{
+			name:    "password without domain",
+			auth:    CloudAuth{AuthURL: "https://iam", Region: "eu-de", ProjectName: "p", UserName: "u", Password: "pw"},
+			wantErr: true,
+		},
+		{
+			name:    "password without user",
+			auth:    CloudAuth{AuthURL: "https://iam", Region: "eu-de", ProjectName: "p", DomainName: "d", Password: "pw"},
+			wantErr: true,
+		},
+		{
+			name: "ids",
+			auth: CloudAuth{AuthURL: "https://iam", Region: "eu-de", ProjectID: "pid", DomainID: "did", UserName: "u", Password: "pw"},
+		},
+		{
+			name:    "project name and id",
+			auth:    CloudAuth{AuthURL: "https://iam", Region: "eu-de", ProjectName: "p", ProjectID: "pid", AccessKey: "ak", SecretKey: "sk"},
+			wantErr: true,
+		},
+		{
+			name:    "domain name and id",
+			auth:    CloudAuth{AuthURL: "https://iam", Region: "eu-de", ProjectName: "p", DomainName: "d", DomainID: "did", UserName: "u", Password: "pw"},
+			wantErr: true,
+		},
+		{
+			name:    "user name and id",
+			auth:    CloudAuth{AuthURL: "https://iam", Region: "eu-de", ProjectID: "pid", DomainName: "d", UserName: "u", UserID: "uid", Password: "pw"},
+			wantErr: true,
+		},
+		{
+			name: "user id with project id",
+			auth: CloudAuth{AuthURL: "https://iam", Region: "eu-de", ProjectID: "pid", UserID: "uid", Password: "pw"},
+		},
+		{
+			name:    "user id with project name",
+			auth:    CloudAuth{AuthURL: "https://iam", Region: "eu-de", ProjectName: "p", DomainName: "d", UserID: "uid", Password: "pw"},
+			wantErr: true,
+		},
+		{
+			name:    "no credentials",
+			auth:    CloudAuth{AuthURL: "https://iam", Region: "eu-de", ProjectName: "p"},
+			wantErr: true,
+		},
+		{
+			name:    "no region",
+			auth:    CloudAuth{AuthURL: "https://iam", ProjectName: "p", AccessKey: "ak", SecretKey: "sk"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.auth.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateNamespace(t *testing.T) {
+	tests := []struct {
+		namespace string
+		allowAll  bool
+		wantErr   bool
+	}{
+		{namespace: "SYS.ELB"},
+		{namespace: "SERVICE.BMS"},
+		{namespace: "CUSTOM_NS.my-app"},
+		{namespace: "all", allowAll: true},
+		{namespace: "all", wantErr: true},
+		{namespace: "ELB", wantErr: true},
+		{namespace: "SYS.ELB.X", wantErr: true},
+		{namespace: "SYS ELB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			err := validateNamespace(tt.namespace, tt.allowAll)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateNamespace(%q, %v) error = %v, wantErr %v", tt.namespace, tt.allowAll, err, tt.wantErr)
+			}
+		})
+	}
+}
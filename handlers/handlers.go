@@ -8,7 +8,17 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+)
+
+const (
+	scrapeTimeoutOffset = 500 * time.Millisecond
+
+	// allServices requests every namespace found by the namespace discovery.
+	allServices = "all"
 )
 
 func Health(w http.ResponseWriter, r *http.Request) {
@@ -20,53 +30,214 @@ func Health(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func Metrics(cloudConfig *config.CloudConfig) func(w http.ResponseWriter, r *http.Request) {
+// State bundles everything scrapes are served with, built from a single
+// configuration, so that it can be replaced as a whole when the configuration
+// is reloaded.
+type State struct {
+	CloudConfig *config.CloudConfig
+	ClientPool  *collector.ClientPool
+	Poller      *collector.Poller
+	Coalescer   *collector.ScrapeCoalescer
+	Discovery   *collector.NamespaceDiscovery
+}
+
+// Metrics serves the scrapes with the state returned by current at the time of
+// every scrape.
+func Metrics(current func() *State) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		state := current()
+		cloudConfig, clientPool, poller, coalescer, discovery := state.CloudConfig, state.ClientPool, state.Poller, state.Coalescer, state.Discovery
+
+		var profile config.Profile
+		if name := r.URL.Query().Get("profile"); name != "" {
+			p, err := cloudConfig.GetProfile(name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			profile = *p
+		}
+
 		target := r.URL.Query().Get("services")
+		if target == "" && len(profile.Services) > 0 {
+			target = strings.Join(profile.Services, ",")
+		}
+		if target == "" {
+			target = strings.Join(cloudConfig.Global.DefaultServices, ",")
+		}
 		if target == "" {
 			http.Error(w, "'target' parameter must be specified", http.StatusBadRequest)
 			return
 		}
 
+		account, err := cloudConfig.GetAccount(r.URL.Query().Get("account"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		queryOverrides, err := getQueryOverrides(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		queryOverrides = profile.QueryOptions.Merge(queryOverrides)
+
 		targets := strings.Split(target, ",")
+		if target == allServices {
+			targets, err = discovery.Namespaces(r.Context(), account)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("discovering namespaces failed: %s", err.Error()), http.StatusInternalServerError)
+				return
+			}
+		}
+
 		registry := prometheus.NewRegistry()
 
-		slog.Info("collecting metrics", "targets", targets)
-		cloudEyeExporter, err := collector.NewCloudEyeExporter(cloudConfig, targets)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			_, err := w.Write([]byte(err.Error()))
+		polledTargets, scrapedTargets := splitPolledTargets(account.Name, targets, poller)
+		if len(polledTargets) > 0 {
+			slog.Info("serving polled metrics", "account", account.Name, "targets", polledTargets)
+			registry.MustRegister(poller.Collector(account.Name, polledTargets))
+		}
+
+		if len(scrapedTargets) > 0 {
+			slog.Info("collecting metrics", "account", account.Name, "targets", scrapedTargets)
+			cloudEyeExporter, err := collector.NewCloudEyeExporter(r.Context(), cloudConfig, clientPool, account, scrapedTargets)
 			if err != nil {
-				slog.Error(fmt.Sprintf("writing response body failed: %s", err.Error()))
+				w.WriteHeader(http.StatusInternalServerError)
+				_, err := w.Write([]byte(err.Error()))
+				if err != nil {
+					slog.Error(fmt.Sprintf("writing response body failed: %s", err.Error()))
+					return
+				}
 				return
 			}
-			return
+			cloudEyeExporter.QueryOverrides = queryOverrides
+			if profile.ScrapeBatchSize > 0 {
+				cloudEyeExporter.ScrapeBatchSize = profile.ScrapeBatchSize
+			}
+			registry.MustRegister(coalescer.Collector(r.Context(), getScrapeTimeout(r), getScrapeKey(account.Name, scrapedTargets, queryOverrides), cloudEyeExporter))
+		}
+
+		h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+		h.ServeHTTP(w, r)
+	}
+}
+
+// getQueryOverrides parses the window, period, filter and additional_filters
+// url parameters, which take precedence over the query options of the
+// configuration.
+func getQueryOverrides(r *http.Request) (config.QueryOptions, error) {
+	var queryOverrides config.QueryOptions
+	var err error
+
+	if window := r.URL.Query().Get("window"); window != "" {
+		queryOverrides.Window, err = time.ParseDuration(window)
+		if err != nil {
+			return queryOverrides, fmt.Errorf("invalid 'window' parameter: %w", err)
 		}
-		registry.MustRegister(cloudEyeExporter)
+	}
+
+	if period := r.URL.Query().Get("period"); period != "" {
+		queryOverrides.Period, err = strconv.Atoi(period)
 		if err != nil {
-			slog.Error(fmt.Sprintf("registering cloudeye collector in prometheus failed: %+v, err: %s", targets, err.Error()))
+			return queryOverrides, fmt.Errorf("invalid 'period' parameter: %w", err)
+		}
+	}
+
+	queryOverrides.Filter = r.URL.Query().Get("filter")
+
+	if additionalFilters := r.URL.Query().Get("additional_filters"); additionalFilters != "" {
+		queryOverrides.AdditionalFilters = strings.Split(additionalFilters, ",")
+	}
+
+	return queryOverrides, queryOverrides.Validate()
+}
+
+// getScrapeTimeout returns the timeout Prometheus announces for the scrape,
+// shortened by an offset that leaves time to serve the collected metrics.
+func getScrapeTimeout(r *http.Request) time.Duration {
+	header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if header == "" {
+		return 0
+	}
+
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("parsing scrape timeout header %q failed: %s", header, err.Error()))
+		return 0
+	}
+
+	timeout := time.Duration(seconds*float64(time.Second)) - scrapeTimeoutOffset
+	if timeout <= 0 {
+		return 0
+	}
+
+	return timeout
+}
+
+// getScrapeKey identifies the scrapes that yield the same result, regardless
+// of the order the namespaces were requested in.
+func getScrapeKey(account string, targets []string, queryOverrides config.QueryOptions) string {
+	namespaces := slices.Clone(targets)
+	slices.Sort(namespaces)
+	namespaces = slices.Compact(namespaces)
+
+	return fmt.Sprintf("%s|%s|%+v", account, strings.Join(namespaces, ","), queryOverrides)
+}
+
+func splitPolledTargets(account string, targets []string, poller *collector.Poller) ([]string, []string) {
+	if poller == nil {
+		return nil, targets
+	}
+
+	var polledTargets, scrapedTargets []string
+	for _, target := range targets {
+		if poller.IsPolled(account, target) {
+			polledTargets = append(polledTargets, target)
+			continue
+		}
+		scrapedTargets = append(scrapedTargets, target)
+	}
+
+	return polledTargets, scrapedTargets
+}
+
+// Reload reloads the configuration on POST requests.
+func Reload(reload func() error) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST requests are allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
-		h.ServeHTTP(w, r)
+		if err := reload(); err != nil {
+			http.Error(w, fmt.Sprintf("reloading configuration failed: %s", err.Error()), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
 	}
 }
 
+func Internal() http.Handler {
+	return promhttp.HandlerFor(collector.InternalRegistry, promhttp.HandlerOpts{})
+}
+
 func Welcome(metricsPath string) func(w http.ResponseWriter, r *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		var links strings.Builder
+		for _, namespace := range collector.GetNamespaces() {
+			links.WriteString(fmt.Sprintf("             <p><a href='%s?services=%s'>%s Metrics</a></p>\n", metricsPath, namespace, strings.TrimPrefix(namespace, "SYS.")))
+		}
+
 		w.WriteHeader(http.StatusOK)
 		_, err := w.Write([]byte(`<html>
              <head><title>Open Telekom Cloud CloudEye Exporter</title></head>
              <body>
              <h1>Open Telekom Cloud CloudEye Exporter</h1>
-             <p><a href='` + metricsPath + "?services=SYS.ELB" + `'>ELB Metrics</a></p>
-             <p><a href='` + metricsPath + "?services=SYS.RDS" + `'>RDS Metrics</a></p>
-             <p><a href='` + metricsPath + "?services=SYS.DCS" + `'>DCS Metrics</a></p>
-             <p><a href='` + metricsPath + "?services=SYS.NAT" + `'>NAT Metrics</a></p>
-             <p><a href='` + metricsPath + "?services=SYS.VPC" + `'>VPC Metrics</a></p>
-             <p><a href='` + metricsPath + "?services=SYS.ECS" + `'>ECS Metrics</a></p>
-             </body>
+             <p><a href='` + metricsPath + "?services=" + allServices + `'>All Metrics</a></p>
+` + links.String() + `             </body>
              </html>`))
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"github.com/akyriako/cloudeye-exporter/config"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetQueryOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    config.QueryOptions
+		wantErr bool
+	}{
+		{name: "none"},
+		{
+			name:  "all",
+			query: "window=1h&period=300&filter=max&additional_filters=min,sum",
+			want:  config.QueryOptions{Window: time.Hour, Period: 300, Filter: "max", AdditionalFilters: []string{"min", "sum"}},
+		},
+		{name: "invalid window", query: "window=10", wantErr: true},
+		{name: "period not a number", query: "period=5m", wantErr: true},
+		{name: "invalid period", query: "period=60", wantErr: true},
+		{name: "invalid filter", query: "filter=avg", wantErr: true},
+		{name: "invalid additional filter", query: "additional_filters=max,p99", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/metrics?services=SYS.ELB&"+tt.query, nil)
+
+			got, err := getQueryOverrides(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getQueryOverrides() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Window != tt.want.Window || got.Period != tt.want.Period || got.Filter != tt.want.Filter ||
+				!slices.Equal(got.AdditionalFilters, tt.want.AdditionalFilters) {
+				t.Errorf("getQueryOverrides() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetScrapeTimeout(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{header: "", want: 0},
+		{header: "10", want: 10*time.Second - scrapeTimeoutOffset},
+		{header: "2.5", want: 2 * time.Second},
+		{header: "0.4", want: 0},
+		{header: "ten", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", tt.header)
+
+			if got := getScrapeTimeout(r); got != tt.want {
+				t.Errorf("getScrapeTimeout() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricsTarget(t *testing.T) {
+	tests := []struct {
+		name            string
+		query           string
+		defaultServices []string
+		want            string
+	}{
+		{name: "none", query: "account=missing", want: "'target' parameter must be specified"},
+		{name: "default services", query: "account=missing", defaultServices: []string{"SYS.ECS"}, want: "account not found"},
+		{name: "profile", query: "profile=network&account=missing", want: "account not found"},
+		{name: "missing profile", query: "profile=missing&services=SYS.ECS", want: "profile not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloudConfig := &config.CloudConfig{
+				Global: config.Global{
+					DefaultServices: tt.defaultServices,
+					Profiles:        map[string]config.Profile{"network": {Services: []string{"SYS.ELB"}}},
+				},
+				Accounts: []config.Account{{Name: "production"}},
+			}
+			state := &State{CloudConfig: cloudConfig}
+
+			w := httptest.NewRecorder()
+			Metrics(func() *State { return state })(w, httptest.NewRequest(http.MethodGet, "/metrics?"+tt.query, nil))
+
+			if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), tt.want) {
+				t.Errorf("response = %d %q, want %d %q", w.Code, w.Body.String(), http.StatusBadRequest, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetScrapeKey(t *testing.T) {
+	key := getScrapeKey("production", []string{"SYS.ELB", "SYS.ECS"}, config.QueryOptions{})
+
+	if got := getScrapeKey("production", []string{"SYS.ECS", "SYS.ELB", "SYS.ECS"}, config.QueryOptions{}); got != key {
+		t.Errorf("getScrapeKey() = %q, want %q regardless of order and duplicates", got, key)
+	}
+	if got := getScrapeKey("staging", []string{"SYS.ELB", "SYS.ECS"}, config.QueryOptions{}); got == key {
+		t.Errorf("getScrapeKey() = %q for another account", got)
+	}
+	if got := getScrapeKey("production", []string{"SYS.ELB", "SYS.ECS"}, config.QueryOptions{Period: 300}); got == key {
+		t.Errorf("getScrapeKey() = %q for other query options", got)
+	}
+}
@@ -1,46 +1,73 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"github.com/akyriako/cloudeye-exporter/collector"
 	"github.com/akyriako/cloudeye-exporter/config"
 	"github.com/akyriako/cloudeye-exporter/handlers"
 	"log/slog"
 	"net/http"
 	"os"
-	"strings"
+	"path/filepath"
 )
 
 var (
 	cloudConfigFlag  = flag.String("config", "./clouds.yaml", "path to the cloud configuration file")
 	enableFilterFlag = flag.Bool("enable-filters", false, "enabling monitoring metric filter")
+	metricFilterFlag = flag.String("metric-filters", "", "path to a metric filter file, merged with the embedded filters")
+	watchConfigFlag  = flag.Duration("watch-config", 0, "interval to check the configuration files for changes and reload them, 0 disables watching")
+	cloudFlag        = flag.String("cloud", "", "name of the cloud to use from a standard OpenStack clouds.yaml, defaults to OS_CLOUD")
+	checkConfigFlag  = flag.Bool("check-config", false, "validate the configuration and metric filter files and exit")
 	debugFlag        = flag.Bool("debug", false, "debug mode")
 
 	logger *slog.Logger
+
+	// set by goreleaser at build time
+	version = "dev"
+	commit  = "none"
 )
 
 const (
-	exitCodeConfigurationError  int = 1
-	exitCodeListenAndServeError int = 2
+	exitCodeConfigurationError        int = 1
+	exitCodeListenAndServeError       int = 2
+	exitCodeConfigurationSyntaxError  int = 3
+	exitCodeConfigurationInvalidError int = 4
 )
 
 func main() {
 	flag.Parse()
 
 	initializeLogger()
-	cloudConfig, err := config.GetConfigFromFile(*cloudConfigFlag, *enableFilterFlag)
-	if err != nil {
-		wd, wderr := os.Getwd()
-		if wderr != nil {
-			slog.Error(fmt.Sprintf("parsing cloud config failed: %s", wderr.Error()))
-			os.Exit(exitCodeConfigurationError)
+	collector.SetBuildInfo(version, commit)
+
+	if *checkConfigFlag {
+		_, err := loadConfig()
+		if err != nil {
+			exitOnConfigurationError(err)
 		}
 
-		slog.Error(fmt.Sprintf("parsing cloud config at %s%s failed: %s", wd, strings.Trim(*cloudConfigFlag, "."), err.Error()))
-		os.Exit(exitCodeConfigurationError)
+		slog.Info(fmt.Sprintf("cloud config at %s is valid", *cloudConfigFlag))
+		return
+	}
+
+	reloader := &reloader{}
+	err := reloader.load()
+	if err != nil {
+		exitOnConfigurationError(err)
+	}
+	collector.ObserveConfigReload(nil)
+
+	go reloader.reloadOnSignal()
+	if *watchConfigFlag > 0 {
+		go reloader.reloadOnChange(*watchConfigFlag)
 	}
 
-	http.HandleFunc(cloudConfig.Global.MetricsPath, handlers.Metrics(cloudConfig))
+	cloudConfig := reloader.current().CloudConfig
+	http.HandleFunc(cloudConfig.Global.MetricsPath, handlers.Metrics(reloader.current))
+	http.Handle(cloudConfig.Global.InternalPath, handlers.Internal())
+	http.HandleFunc("/-/reload", handlers.Reload(reloader.reload))
 	http.HandleFunc("/healthz", handlers.Health)
 	http.HandleFunc("/livez", handlers.Health)
 	http.HandleFunc("/readyz", handlers.Health)
@@ -53,6 +80,27 @@ func main() {
 	}
 }
 
+// exitOnConfigurationError exits with a code telling files that cannot be
+// parsed apart from invalid configurations and any other failure.
+func exitOnConfigurationError(err error) {
+	path, abserr := filepath.Abs(*cloudConfigFlag)
+	if abserr != nil {
+		slog.Error(fmt.Sprintf("parsing cloud config failed: %s", abserr.Error()))
+		os.Exit(exitCodeConfigurationError)
+	}
+
+	slog.Error(fmt.Sprintf("parsing cloud config at %s failed: %s", path, err.Error()))
+
+	switch {
+	case errors.Is(err, config.ErrSyntax):
+		os.Exit(exitCodeConfigurationSyntaxError)
+	case errors.Is(err, config.ErrInvalid):
+		os.Exit(exitCodeConfigurationInvalidError)
+	default:
+		os.Exit(exitCodeConfigurationError)
+	}
+}
+
 func initializeLogger() {
 	levelInfo := slog.LevelInfo
 	if *debugFlag {
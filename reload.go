@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/akyriako/cloudeye-exporter/collector"
+	"github.com/akyriako/cloudeye-exporter/config"
+	"github.com/akyriako/cloudeye-exporter/handlers"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// reloader builds the state of the exporter from the configuration file. A
+// reload replaces the state only once the new configuration was read and
+// validated, scrapes keep being served with the previous one otherwise. The
+// pooled clients, the cached resources, the discovered namespaces, the polled
+// snapshots and the transport are taken over from the previous state as long
+// as the settings they depend on did not change.
+type reloader struct {
+	state      atomic.Pointer[handlers.State]
+	stopPoller context.CancelFunc
+	sync.Mutex
+}
+
+func (r *reloader) current() *handlers.State {
+	return r.state.Load()
+}
+
+func (r *reloader) load() error {
+	r.Lock()
+	defer r.Unlock()
+
+	cloudConfig, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	var clientPool *collector.ClientPool
+	var discovery *collector.NamespaceDiscovery
+
+	previous := r.state.Load()
+	if previous != nil {
+		warnOnStaticChanges(previous.CloudConfig, cloudConfig)
+		clientPool = previous.ClientPool.Reload(cloudConfig)
+		discovery = previous.Discovery.Reload(cloudConfig, clientPool)
+	} else {
+		clientPool = collector.NewClientPool(cloudConfig)
+		discovery = collector.NewNamespaceDiscovery(cloudConfig, clientPool)
+	}
+
+	state := &handlers.State{
+		CloudConfig: cloudConfig,
+		ClientPool:  clientPool,
+		Coalescer:   collector.NewScrapeCoalescer(cloudConfig.Global.ScrapeCacheTTL),
+		Discovery:   discovery,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if cloudConfig.Global.Polling.Enabled {
+		if previous != nil && previous.Poller != nil {
+			state.Poller = previous.Poller.Reload(cloudConfig, clientPool)
+		} else {
+			state.Poller = collector.NewPoller(cloudConfig, clientPool)
+		}
+		state.Poller.Start(ctx)
+	}
+
+	if previous == nil || previous.ClientPool.ResourceCache() != clientPool.ResourceCache() {
+		if previous != nil {
+			collector.InternalRegistry.Unregister(previous.ClientPool.ResourceCache())
+		}
+		collector.InternalRegistry.MustRegister(clientPool.ResourceCache())
+	}
+
+	r.state.Store(state)
+	if r.stopPoller != nil {
+		r.stopPoller()
+	}
+	r.stopPoller = cancel
+
+	return nil
+}
+
+// loadConfig reads and validates the configuration, including the checks that
+// depend on the registered namespace providers.
+func loadConfig() (*config.CloudConfig, error) {
+	cloudConfig, err := config.GetConfigFromFile(*cloudConfigFlag, *enableFilterFlag, *metricFilterFlag, *cloudFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	err = collector.CheckTagLabels(cloudConfig.Global.TagLabels)
+	if err != nil {
+		return nil, err
+	}
+
+	return cloudConfig, nil
+}
+
+// reload loads the configuration again and records the outcome.
+func (r *reloader) reload() error {
+	err := r.load()
+	collector.ObserveConfigReload(err)
+	if err != nil {
+		slog.Error(fmt.Sprintf("reloading cloud config failed, keeping the current one: %s", err.Error()))
+		return err
+	}
+
+	slog.Info("reloaded cloud config")
+	return nil
+}
+
+// reloadOnSignal reloads the configuration on every SIGHUP.
+func (r *reloader) reloadOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		_ = r.reload()
+	}
+}
+
+// reloadOnChange reloads the configuration whenever the modification time of
+// the configuration file, the metric filter file or a credential file changes.
+func (r *reloader) reloadOnChange(interval time.Duration) {
+	modified := r.modTimes()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		current := r.modTimes()
+		if current == modified {
+			continue
+		}
+
+		modified = current
+		_ = r.reload()
+	}
+}
+
+func (r *reloader) modTimes() string {
+	cloudConfig := r.current().CloudConfig
+	paths := append([]string{*cloudConfigFlag}, cloudConfig.CredentialFiles()...)
+	if cloudConfig.Global.MetricFilters != "" {
+		paths = append(paths, cloudConfig.Global.MetricFilters)
+	}
+
+	modTimes := ""
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		modTimes += fmt.Sprintf("%s=%d;", path, info.ModTime().UnixNano())
+	}
+
+	return modTimes
+}
+
+// warnOnStaticChanges warns about changed settings that only apply once the
+// exporter is restarted.
+func warnOnStaticChanges(previous *config.CloudConfig, current *config.CloudConfig) {
+	if previous.Global.Port != current.Global.Port ||
+		previous.Global.MetricsPath != current.Global.MetricsPath ||
+		previous.Global.InternalPath != current.Global.InternalPath {
+		slog.Warn("changes of port, metrics_path and internal_metrics_path require a restart of the exporter")
+	}
+}